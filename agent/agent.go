@@ -17,10 +17,6 @@ import (
 	"go.uber.org/zap"
 )
 
-const (
-	Kind = "discovery"
-)
-
 type Agent interface {
 	Start(ctx context.Context, cancelFunc context.CancelFunc) error
 	Stop(ctx context.Context)
@@ -49,18 +45,27 @@ type diodeAgent struct {
 var _ Agent = (*diodeAgent)(nil)
 
 func New(logger *zap.Logger, c config.Config) (Agent, error) {
+	stateDir, err := resolveStateDir(c.DiodeAgent.DiodeConfig.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	c.DiodeAgent.DiodeConfig.StateDir = stateDir
+	agentID, err := loadAgentID(logger, stateDir)
+	if err != nil {
+		return nil, err
+	}
 	var s pusher.Pusher
-	var err error
-	if s, err = pusher.New(logger, c); err != nil {
+	if s, err = pusher.New(logger, c, agentID); err != nil {
 		return nil, err
 	}
 	addr := c.DiodeAgent.DiodeConfig.Host + ":" + c.DiodeAgent.DiodeConfig.Port
-	return &diodeAgent{logger: logger, config: c, pusher: s, stat: config.Status{Version: c.Version}, addr: addr}, nil
+	return &diodeAgent{logger: logger, config: c, pusher: s, addr: addr,
+		stat: config.Status{Version: c.Version, AgentID: agentID, Tags: c.DiodeAgent.Tags}}, nil
 }
 
 func (a *diodeAgent) startConfigPolicies(agentCtx context.Context) error {
 	for name, policy := range a.config.DiodeAgent.Policies {
-		be, err := factory.GetBackend(policy.Backend)
+		be, err := factory.GetBackend(policy.Backend, policy.Kind)
 		if err != nil {
 			return err
 		}
@@ -68,9 +73,6 @@ func (a *diodeAgent) startConfigPolicies(agentCtx context.Context) error {
 		if ok {
 			return errors.New("policy '" + name + "' already exists")
 		}
-		if policy.Kind != Kind {
-			return errors.New("invalid policy kind")
-		}
 		if err = be.Configure(a.logger, name, a.pusher.GetChannel(), policy.Data, policy.Config); err != nil {
 			return err
 		}
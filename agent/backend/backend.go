@@ -19,8 +19,26 @@ const (
 	Offline
 )
 
+// policy kinds a backend may implement
+const (
+	DiscoveryKind  = "discovery"
+	ValidationKind = "validation"
+)
+
 type RunningStatus int
 
+var runningStatusText = map[RunningStatus]string{
+	Unknown:      "unknown",
+	Running:      "running",
+	BackendError: "backend_error",
+	AgentError:   "agent_error",
+	Offline:      "offline",
+}
+
+func (s RunningStatus) String() string {
+	return runningStatusText[s]
+}
+
 type State struct {
 	Status            RunningStatus
 	RestartCount      int64
@@ -29,6 +47,16 @@ type State struct {
 	LastRestartReason string
 }
 
+// PollError describes a failed poll of a backend service for a single device
+type PollError struct {
+	Hostname  string    `json:"hostname" yaml:"hostname"`
+	Namespace string    `json:"namespace" yaml:"namespace"`
+	Service   string    `json:"service" yaml:"service"`
+	Status    int64     `json:"status" yaml:"status"`
+	Category  string    `json:"category" yaml:"category"`
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+}
+
 type Backend interface {
 	Configure(*zap.Logger, string, chan []byte, map[string]interface{}, map[string]interface{}) error
 	Version() (string, error)
@@ -39,4 +67,5 @@ type Backend interface {
 	GetStartTime() time.Time
 	GetCapabilities() (map[string]interface{}, error)
 	GetRunningStatus() (RunningStatus, string, error)
+	GetPollErrors() []PollError
 }
@@ -11,9 +11,15 @@ import (
 	"github.com/orb-community/diode/agent/backend/suzieq"
 )
 
-func GetBackend(backendType string) (backend.Backend, error) {
+func GetBackend(backendType string, kind string) (backend.Backend, error) {
 	if backendType == "suzieq" {
-		return suzieq.New(), nil
+		switch kind {
+		case backend.DiscoveryKind:
+			return suzieq.New(), nil
+		case backend.ValidationKind:
+			return suzieq.NewValidation(), nil
+		}
+		return nil, errors.New("invalid policy kind")
 	}
 	return nil, errors.New("backend type not found")
 }
@@ -0,0 +1,168 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orb-community/diode/envelope"
+)
+
+// DeltaTables are the discovery tables pushed as deltas between runs, along
+// with the record fields identifying a record
+var DeltaTables = map[string][]string{
+	"device":     {"namespace", "hostname"},
+	"interfaces": {"namespace", "hostname", "ifname"},
+	"inventory":  {"namespace", "hostname", "name"},
+}
+
+// record fields changing on every poll, left out of the fingerprint
+var volatileFields = []string{"timestamp"}
+
+const defaultFullResyncInterval = 24 * time.Hour
+
+// deltaTracker keeps a fingerprint of every record pushed for the delta
+// tables, so a run only pushes the records added, changed or removed since
+// the previous successful run
+type deltaTracker struct {
+	mutex          sync.Mutex
+	resyncInterval time.Duration
+	lastFull       time.Time
+	forceFull      bool
+	full           bool
+	// fingerprints of the last successful run, by table and record key
+	fingerprints map[string]map[string]string
+	// fingerprints and hosts seen by the running run
+	current map[string]map[string]string
+	hosts   map[string]bool
+}
+
+func newDeltaTracker(resyncInterval time.Duration) *deltaTracker {
+	return &deltaTracker{resyncInterval: resyncInterval}
+}
+
+// requestFull makes the next run push the full tables
+func (t *deltaTracker) requestFull() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.forceFull = true
+}
+
+// beginRun starts tracking a run, returning the mode its envelopes are pushed with
+func (t *deltaTracker) beginRun() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.current = make(map[string]map[string]string, len(DeltaTables))
+	t.hosts = make(map[string]bool)
+	t.full = t.forceFull || t.fingerprints == nil || time.Since(t.lastFull) >= t.resyncInterval
+	if t.full {
+		return envelope.ModeFull
+	}
+	return envelope.ModeDelta
+}
+
+// filter records the fingerprints of the table records and returns the ones
+// to push, which are all of them on full runs
+func (t *deltaTracker) filter(table string, records []interface{}) []interface{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	fields := DeltaTables[table]
+	if t.current[table] == nil {
+		t.current[table] = make(map[string]string, len(records))
+	}
+	changed := make([]interface{}, 0)
+	for _, r := range records {
+		record, ok := r.(map[string]interface{})
+		if !ok {
+			changed = append(changed, r)
+			continue
+		}
+		key := recordKey(record, fields)
+		hash := fingerprint(record)
+		t.current[table][key] = hash
+		t.hosts[recordKey(record, fields[:2])] = true
+		if t.full || t.fingerprints[table][key] != hash {
+			changed = append(changed, r)
+		}
+	}
+	return changed
+}
+
+// endRun returns, by table, the keys of the records removed since the
+// previous run. Only records of the hosts polled by this run are removed, a
+// host missing from the run keeps its records until it is polled again. When
+// the run did not complete, the previous fingerprints are kept so the
+// changes are pushed again by the next run
+func (t *deltaTracker) endRun(complete bool) map[string][]map[string]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !complete {
+		return nil
+	}
+	removed := make(map[string][]map[string]string)
+	next := make(map[string]map[string]string, len(DeltaTables))
+	for table, fields := range DeltaTables {
+		next[table] = make(map[string]string)
+		for key, hash := range t.fingerprints[table] {
+			if _, ok := t.current[table][key]; ok {
+				continue
+			}
+			host := strings.Join(strings.SplitN(key, "\x00", 3)[:2], "\x00")
+			if t.hosts[host] {
+				removed[table] = append(removed[table], keyFields(key, fields))
+				continue
+			}
+			next[table][key] = hash
+		}
+		for key, hash := range t.current[table] {
+			next[table][key] = hash
+		}
+	}
+	t.fingerprints = next
+	if t.full {
+		t.lastFull = time.Now()
+		t.forceFull = false
+	}
+	return removed
+}
+
+func recordKey(record map[string]interface{}, fields []string) string {
+	values := make([]string, 0, len(fields))
+	for _, f := range fields {
+		v, _ := record[f].(string)
+		values = append(values, v)
+	}
+	return strings.Join(values, "\x00")
+}
+
+func keyFields(key string, fields []string) map[string]string {
+	values := strings.SplitN(key, "\x00", len(fields))
+	ret := make(map[string]string, len(fields))
+	for i, f := range fields {
+		if i < len(values) {
+			ret[f] = values[i]
+		}
+	}
+	return ret
+}
+
+func fingerprint(record map[string]interface{}) string {
+	stable := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		stable[k] = v
+	}
+	for _, f := range volatileFields {
+		delete(stable, f)
+	}
+	// map keys are sorted by the json encoder, so equal records hash the same
+	b, _ := json.Marshal(stable)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/orb-community/diode/envelope"
+	"github.com/stretchr/testify/assert"
+)
+
+func iface(hostname, ifname, state string) map[string]interface{} {
+	return map[string]interface{}{"namespace": "ns", "hostname": hostname, "ifname": ifname,
+		"state": state, "timestamp": time.Now().UnixNano()}
+}
+
+func TestDeltaTracker(t *testing.T) {
+	d := newDeltaTracker(time.Hour)
+
+	assert.Equal(t, envelope.ModeFull, d.beginRun())
+	records := []interface{}{iface("h1", "eth0", "up"), iface("h1", "eth1", "up"), iface("h2", "eth0", "up")}
+	assert.Len(t, d.filter("interfaces", records), 3)
+	assert.Empty(t, d.endRun(true))
+
+	// only the changed record is pushed, the missing one of a polled host is removed
+	assert.Equal(t, envelope.ModeDelta, d.beginRun())
+	records = []interface{}{iface("h1", "eth0", "down"), iface("h2", "eth0", "up")}
+	changed := d.filter("interfaces", records)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, "down", changed[0].(map[string]interface{})["state"])
+	assert.Equal(t, map[string][]map[string]string{
+		"interfaces": {{"namespace": "ns", "hostname": "h1", "ifname": "eth1"}},
+	}, d.endRun(true))
+
+	// records of hosts missing from the run are kept
+	d.beginRun()
+	assert.Empty(t, d.filter("interfaces", []interface{}{iface("h1", "eth0", "down")}))
+	assert.Empty(t, d.endRun(true))
+
+	// an incomplete run keeps the previous fingerprints
+	d.beginRun()
+	assert.Len(t, d.filter("interfaces", []interface{}{iface("h1", "eth0", "up")}), 1)
+	assert.Nil(t, d.endRun(false))
+	d.beginRun()
+	assert.Len(t, d.filter("interfaces", []interface{}{iface("h1", "eth0", "up")}), 1)
+	d.endRun(true)
+
+	d.requestFull()
+	assert.Equal(t, envelope.ModeFull, d.beginRun())
+	assert.Len(t, d.filter("interfaces", []interface{}{iface("h1", "eth0", "up")}), 1)
+	d.endRun(true)
+	assert.Equal(t, envelope.ModeDelta, d.beginRun())
+}
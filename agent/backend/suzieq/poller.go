@@ -0,0 +1,136 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/orb-community/diode/agent/backend"
+	"github.com/orb-community/diode/envelope"
+	"go.uber.org/zap"
+)
+
+const (
+	PollErrors = envelope.PollErrorsTable
+
+	AuthenticationFailure = "authentication"
+	TimeoutFailure        = "timeout"
+	UnsupportedFailure    = "unsupported"
+	UnreachableFailure    = "unreachable"
+	UnknownFailure        = "unknown"
+	// RecoveredPoll reports a device service polled again after failing
+	RecoveredPoll = "recovered"
+)
+
+// sq-poller reports the outcome of each service poll with http like status codes
+var pollStatusCategory = map[int64]string{
+	401: AuthenticationFailure,
+	403: AuthenticationFailure,
+	408: TimeoutFailure,
+	504: TimeoutFailure,
+	404: UnsupportedFailure,
+	405: UnsupportedFailure,
+	415: UnsupportedFailure,
+	501: UnsupportedFailure,
+	502: UnreachableFailure,
+	503: UnreachableFailure,
+}
+
+type pollerRecord struct {
+	Hostname  string  `json:"hostname"`
+	Namespace string  `json:"namespace"`
+	Service   string  `json:"service"`
+	Status    float64 `json:"status"`
+	Timestamp float64 `json:"timestamp"`
+}
+
+func pollFailed(status int64) bool {
+	return status != 0 && (status < 200 || status > 299)
+}
+
+func pollErrorCategory(status int64) string {
+	if c, ok := pollStatusCategory[status]; ok {
+		return c
+	}
+	return UnknownFailure
+}
+
+func pollErrorKey(namespace, hostname, service string) string {
+	return namespace + "/" + hostname + "/" + service
+}
+
+// processPollerStatus parses the sqPoller records of forwarded tables, keeps
+// the last failure of every device service and returns the changes since the
+// previous records: failures not reported yet or with another status, and
+// recoveries of the reported ones
+func (s *suzieqBackend) processPollerStatus(data interface{}) []backend.PollError {
+	b, err := json.Marshal(data)
+	if err != nil {
+		s.logger.Error("process suzieq poller status error", zap.Error(err), zap.String("policy", s.policyName))
+		return nil
+	}
+	var records []pollerRecord
+	if err = json.Unmarshal(b, &records); err != nil {
+		s.logger.Error("process suzieq poller status error", zap.Error(err), zap.String("policy", s.policyName))
+		return nil
+	}
+
+	s.pollMutex.Lock()
+	defer s.pollMutex.Unlock()
+	var changes []backend.PollError
+	for _, r := range records {
+		forwarded := false
+		for _, d := range Tables {
+			if r.Service == d {
+				forwarded = true
+				break
+			}
+		}
+		if !forwarded {
+			continue
+		}
+		key := pollErrorKey(r.Namespace, r.Hostname, r.Service)
+		status := int64(r.Status)
+		pollError := backend.PollError{
+			Hostname:  r.Hostname,
+			Namespace: r.Namespace,
+			Service:   r.Service,
+			Status:    status,
+			Timestamp: time.UnixMilli(int64(r.Timestamp)).UTC(),
+		}
+		reported, wasFailing := s.pollErrors[key]
+		if !pollFailed(status) {
+			if wasFailing {
+				delete(s.pollErrors, key)
+				pollError.Category = RecoveredPoll
+				changes = append(changes, pollError)
+				s.logger.Info("suzieq poller recovered", zap.String("hostname", r.Hostname), zap.String("namespace", r.Namespace),
+					zap.String("service", r.Service), zap.String("policy", s.policyName))
+			}
+			continue
+		}
+		pollError.Category = pollErrorCategory(status)
+		s.pollErrors[key] = pollError
+		if wasFailing && reported.Status == status {
+			continue
+		}
+		changes = append(changes, pollError)
+		s.logger.Error("suzieq poller failed", zap.String("hostname", r.Hostname), zap.String("namespace", r.Namespace),
+			zap.String("service", r.Service), zap.Int64("status", status), zap.String("category", pollError.Category),
+			zap.String("policy", s.policyName))
+	}
+	return changes
+}
+
+func (s *suzieqBackend) GetPollErrors() []backend.PollError {
+	s.pollMutex.Lock()
+	defer s.pollMutex.Unlock()
+	pollErrors := make([]backend.PollError, 0, len(s.pollErrors))
+	for _, e := range s.pollErrors {
+		pollErrors = append(pollErrors, e)
+	}
+	return pollErrors
+}
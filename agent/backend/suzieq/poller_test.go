@@ -0,0 +1,72 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"testing"
+
+	"github.com/orb-community/diode/agent/backend"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPollErrorCategory(t *testing.T) {
+	cases := map[int64]string{
+		401: AuthenticationFailure,
+		403: AuthenticationFailure,
+		408: TimeoutFailure,
+		504: TimeoutFailure,
+		404: UnsupportedFailure,
+		501: UnsupportedFailure,
+		502: UnreachableFailure,
+		503: UnreachableFailure,
+		500: UnknownFailure,
+		1:   UnknownFailure,
+	}
+	for status, category := range cases {
+		assert.Equal(t, category, pollErrorCategory(status), "status %d", status)
+	}
+	assert.False(t, pollFailed(0))
+	assert.False(t, pollFailed(200))
+	assert.True(t, pollFailed(401))
+}
+
+func pollerRecords(status ...float64) []interface{} {
+	hosts := []string{"h1", "h2"}
+	records := make([]interface{}, 0, len(status))
+	for i, st := range status {
+		records = append(records, map[string]interface{}{"namespace": "ns", "hostname": hosts[i],
+			"service": "device", "status": st, "timestamp": 1684000000000})
+	}
+	return records
+}
+
+func TestProcessPollerStatus(t *testing.T) {
+	s := &suzieqBackend{logger: zap.NewNop(), policyName: "policy", pollErrors: make(map[string]backend.PollError)}
+
+	changes := s.processPollerStatus(pollerRecords(401, 200))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "h1", changes[0].Hostname)
+	assert.Equal(t, AuthenticationFailure, changes[0].Category)
+
+	// the same failure is not reported again, but stays listed in the status
+	assert.Empty(t, s.processPollerStatus(pollerRecords(401, 200)))
+	assert.Len(t, s.GetPollErrors(), 1)
+
+	// a failure with another status is reported again
+	changes = s.processPollerStatus(pollerRecords(504, 200))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, TimeoutFailure, changes[0].Category)
+
+	changes = s.processPollerStatus(pollerRecords(200, 200))
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "h1", changes[0].Hostname)
+	assert.Equal(t, RecoveredPoll, changes[0].Category)
+	assert.Empty(t, s.GetPollErrors())
+
+	// services not forwarded as discovery tables are ignored
+	assert.Empty(t, s.processPollerStatus([]interface{}{map[string]interface{}{"namespace": "ns", "hostname": "h1",
+		"service": "ospfNbr", "status": 401, "timestamp": 1684000000000}}))
+}
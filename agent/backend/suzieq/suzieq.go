@@ -12,24 +12,37 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	yson "github.com/ghodss/yaml"
 	"github.com/go-cmd/cmd"
+	"github.com/google/uuid"
 	"github.com/orb-community/diode/agent/backend"
+	"github.com/orb-community/diode/envelope"
 	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
 	"gopkg.in/yaml.v3"
 )
 
-var Tables = [...]string{"device", "interfaces", "inventory", "vlan"}
+var Tables = [...]string{"device", "interfaces", "inventory", "vlan", "lldp", "arpnd", "routes", "bgp", "devconfig", "macs"}
 
-const PollerTable = "sqPoller"
+// tables that policies opt into through the data "tables" list, they are
+// exported as metrics rather than discovery data
+var MetricTables = [...]string{"ifCounters"}
+
+const (
+	BackendName = "suzieq"
+	PollerTable = "sqPoller"
+)
 
 type suzieqBackend struct {
+	// runMutex guards the fields replaced on every run, which the status
+	// handler reads while the output goroutine starts the next run
+	runMutex      sync.Mutex
 	stopped       bool
 	logger        *zap.Logger
 	policyName    string
-	returnPrefix  string
 	inventoryPath string
 	proc          *cmd.Cmd
 	statusChan    <-chan cmd.Status
@@ -37,23 +50,44 @@ type suzieqBackend struct {
 	startTime     time.Time
 	cancelFunc    context.CancelFunc
 	ctx           context.Context
-	extraConfig   string
+	config        json.RawMessage
+	metricTables  []string
+	interval      time.Duration
+	delta         *deltaTracker
+	mode          string
+	runID         string
+	sequence      int64
+	tableCounts   map[string]int64
+	pollMutex     sync.Mutex
+	pollErrors    map[string]backend.PollError
 }
 
 var _ backend.Backend = (*suzieqBackend)(nil)
 
 func New() backend.Backend {
-	return &suzieqBackend{stopped: false}
+	return &suzieqBackend{stopped: false, pollErrors: make(map[string]backend.PollError)}
+}
+
+// currentProc returns the sq-poller process of the current run
+func (s *suzieqBackend) currentProc() *cmd.Cmd {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	return s.proc
 }
 
 func (s *suzieqBackend) getProcRunningStatus() (backend.RunningStatus, string, error) {
-	status := s.proc.Status()
+	proc := s.currentProc()
+	status := proc.Status()
 	if status.Error != nil {
 		errMsg := fmt.Sprintf("suzieq process error: %v", status.Error)
 		return backend.BackendError, errMsg, status.Error
 	}
 	if status.Complete {
-		err := s.proc.Stop()
+		if s.interval > 0 && s.ctx.Err() == nil {
+			// waiting for the next run
+			return backend.Running, "", nil
+		}
+		err := proc.Stop()
 		return backend.Offline, "suzieq process ended", err
 	}
 	if status.StopTs > 0 {
@@ -78,30 +112,72 @@ func (s *suzieqBackend) Configure(logger *zap.Logger, name string, pusher chan [
 		if err != nil {
 			return err
 		}
-		s.extraConfig = "\"config\":" + string(j) + ","
+		s.config = j
 	}
 
-	d, err := yaml.Marshal(&inventory)
-	if err != nil {
-		return err
+	if interval, ok := data["interval"].(string); ok {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return errors.New("suzieq discovery interval must be positive")
+		}
+		s.interval = d
 	}
 
-	s.inventoryPath = "/tmp/" + name + "_inventory.yml"
-	err = os.WriteFile(s.inventoryPath, d, 0644)
-	if err != nil {
+	resyncInterval := defaultFullResyncInterval
+	if resync, ok := data["full_resync_interval"].(string); ok {
+		d, err := time.ParseDuration(resync)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return errors.New("suzieq full resync interval must be positive")
+		}
+		resyncInterval = d
+	}
+	s.delta = newDeltaTracker(resyncInterval)
+
+	if tables, ok := data["tables"].([]interface{}); ok {
+		for _, t := range tables {
+			table, ok := t.(string)
+			if !ok || !slices.Contains(MetricTables[:], table) {
+				return fmt.Errorf("suzieq table '%v' is not supported", t)
+			}
+			s.metricTables = append(s.metricTables, table)
+		}
+	}
+
+	var err error
+	if s.inventoryPath, err = writeInventory(name, inventory); err != nil {
 		return err
 	}
 
 	s.logger = logger
 	s.policyName = name
-	s.returnPrefix = "{\"" + name + "\":{\"backend\":\"suzieq\", "
 	s.pusher = pusher
 
 	return nil
 }
 
+func writeInventory(name string, inventory interface{}) (string, error) {
+	d, err := yaml.Marshal(&inventory)
+	if err != nil {
+		return "", err
+	}
+	inventoryPath := "/tmp/" + name + "_inventory.yml"
+	if err = os.WriteFile(inventoryPath, d, 0644); err != nil {
+		return "", err
+	}
+	return inventoryPath, nil
+}
+
 func (s *suzieqBackend) Version() (string, error) {
+	return sqVersion()
+}
 
+func sqVersion() (string, error) {
 	envCmd := cmd.NewCmd("sq-poller -v")
 	status := <-envCmd.Start()
 	if len(status.Stdout) == 0 {
@@ -114,6 +190,19 @@ func (s *suzieqBackend) Start(ctx context.Context, cancelFunc context.CancelFunc
 	s.startTime = time.Now()
 	s.cancelFunc = cancelFunc
 	s.ctx = ctx
+	return s.startRun()
+}
+
+// startRun starts a sq-poller run, which is repeated every interval when one
+// is configured, or stops the backend once done otherwise
+func (s *suzieqBackend) startRun() error {
+	s.runID = uuid.NewString()
+	s.mode = s.delta.beginRun()
+	s.sequence = 0
+	tableCounts := make(map[string]int64, len(Tables))
+	for _, t := range Tables {
+		tableCounts[t] = 0
+	}
 
 	sOptions := []string{
 		"-I",
@@ -125,24 +214,30 @@ func (s *suzieqBackend) Start(ctx context.Context, cancelFunc context.CancelFunc
 		"update",
 	}
 
-	s.logger.Info("suzieq startup", zap.Strings("arguments", sOptions), zap.String("policy", s.policyName))
+	s.logger.Info("suzieq startup", zap.Strings("arguments", sOptions), zap.String("mode", s.mode),
+		zap.String("policy", s.policyName))
 
-	s.proc = cmd.NewCmdOptions(cmd.Options{
+	proc := cmd.NewCmdOptions(cmd.Options{
 		Buffered:       false,
 		Streaming:      true,
 		LineBufferSize: cmd.DEFAULT_LINE_BUFFER_SIZE * 2,
 	}, "sq-poller", sOptions...)
-	s.statusChan = s.proc.Start()
+	s.runMutex.Lock()
+	s.proc = proc
+	s.statusChan = proc.Start()
+	s.tableCounts = tableCounts
+	s.runMutex.Unlock()
 
 	matchOutput := regexp.MustCompile(`\bsuzieq.poller.worker.writers.logging - WARNING\b`)
 
 	// log STDOUT and STDERR lines streaming from Cmd
 	go func() {
-		for s.proc.Stdout != nil || s.proc.Stderr != nil || s.proc.Done() != nil {
+		stdout, stderr := proc.Stdout, proc.Stderr
+		for stdout != nil || stderr != nil {
 			select {
-			case line, open := <-s.proc.Stdout:
+			case line, open := <-stdout:
 				if !open {
-					s.proc.Stdout = nil
+					stdout = nil
 					continue
 				}
 				if matchOutput.MatchString(line) {
@@ -151,23 +246,25 @@ func (s *suzieqBackend) Start(ctx context.Context, cancelFunc context.CancelFunc
 				} else {
 					s.logger.Info("suzieq stdout", zap.String("log", line), zap.String("policy", s.policyName))
 				}
-			case line, open := <-s.proc.Stderr:
+			case line, open := <-stderr:
 				if !open {
-					s.proc.Stderr = nil
+					stderr = nil
 					continue
 				}
 				s.logger.Info("suzieq stderr", zap.String("log", line), zap.String("policy", s.policyName))
-			case <-s.proc.Done():
-				s.Stop(ctx)
-				return
 			}
 		}
+		// output streams are only closed after the process has exited,
+		// so every discovery line of the run was already processed here
+		<-proc.Done()
+		s.completeRun(proc)
+		s.scheduleRun()
 	}()
 
 	// wait for simple startup errors
 	time.Sleep(time.Second)
 
-	status := s.proc.Status()
+	status := proc.Status()
 
 	if status.Error != nil {
 		s.logger.Error("suzieq startup error", zap.Error(status.Error), zap.String("policy", s.policyName))
@@ -175,7 +272,7 @@ func (s *suzieqBackend) Start(ctx context.Context, cancelFunc context.CancelFunc
 	}
 
 	if status.Complete {
-		err := s.proc.Stop()
+		err := proc.Stop()
 		if err != nil {
 			s.logger.Error("proc.Stop error", zap.Error(err), zap.String("policy", s.policyName))
 		}
@@ -187,64 +284,170 @@ func (s *suzieqBackend) Start(ctx context.Context, cancelFunc context.CancelFunc
 	return nil
 }
 
+func (s *suzieqBackend) scheduleRun() {
+	if s.interval <= 0 {
+		s.Stop(s.ctx)
+		return
+	}
+	for {
+		select {
+		case <-time.After(s.interval):
+		case <-s.ctx.Done():
+			return
+		}
+		err := s.startRun()
+		if err == nil {
+			return
+		}
+		s.logger.Error("suzieq run startup error, retrying on next interval", zap.Error(err), zap.String("policy", s.policyName))
+	}
+}
+
 func (s *suzieqBackend) proccessDiscovery(data string) {
-	discoveryData := []byte(s.returnPrefix + s.extraConfig + data + "}")
-	var jsonData map[string]map[string]interface{}
-	if err := json.Unmarshal(discoveryData, &jsonData); err != nil {
+	var tables map[string]interface{}
+	if err := json.Unmarshal([]byte("{"+data), &tables); err != nil {
 		s.logger.Error("process suzieq output error", zap.Error(err))
 		return
 	}
 
-	for k, v := range jsonData[s.policyName] {
-		for _, d := range Tables {
-			if k == d {
-				s.pusher <- discoveryData
+	for k, v := range tables {
+		if slices.Contains(Tables[:], k) {
+			records, ok := v.([]interface{})
+			if _, delta := DeltaTables[k]; delta && ok {
+				records = s.delta.filter(k, records)
+				if len(records) == 0 {
+					continue
+				}
+				v = records
 			}
+			if ok {
+				s.countRecords(k, len(records))
+			}
+			run := s.nextRun()
+			s.push(k, v, &run, s.config)
+		}
+		// metric tables are pushed without run info, they are not part of
+		// the discovery snapshot tracked by the receiver
+		if slices.Contains(s.metricTables, k) {
+			s.push(k, v, nil, nil)
 		}
 		if k == PollerTable {
-			status := ""
-			service := ""
-			pollerData := v.([]interface{})
-			for _, pollerField := range pollerData {
-				for k, i := range pollerField.(map[string]interface{}) {
-					if k == "service" {
-						for _, d := range Tables {
-							if i.(string) == d {
-								service = d
-								break
-							}
-						}
-					} else if k == "status" {
-						status = fmt.Sprintf("%v", i)
-					}
-				}
-			}
-			if service != "" && status != "0" {
-				s.logger.Error("suzieq poller for service '"+service+"' failed with status: "+status, zap.String("policy", s.policyName))
+			if changes := s.processPollerStatus(v); len(changes) > 0 {
+				s.pushPollErrors(changes)
 			}
 		}
 	}
 }
 
+// push hands the table records over to the pusher in an envelope
+func (s *suzieqBackend) push(table string, records interface{}, run *envelope.Run, config json.RawMessage) {
+	e, err := envelope.New(s.policyName, BackendName, table, records)
+	if err != nil {
+		s.logger.Error("fail to generate "+table+" envelope", zap.Error(err), zap.String("policy", s.policyName))
+		return
+	}
+	e.Run = run
+	e.Config = config
+	if _, ok := DeltaTables[table]; ok {
+		e.Mode = s.mode
+	}
+	s.send(e)
+}
+
+// pushRemoved hands the keys of the records removed since the previous run over to the pusher
+func (s *suzieqBackend) pushRemoved(table string, keys []map[string]string, run *envelope.Run) {
+	e, err := envelope.New(s.policyName, BackendName, table, []interface{}{})
+	if err != nil {
+		s.logger.Error("fail to generate "+table+" envelope", zap.Error(err), zap.String("policy", s.policyName))
+		return
+	}
+	e.Run = run
+	e.Mode = envelope.ModeDelta
+	e.Removed = keys
+	s.send(e)
+}
+
+func (s *suzieqBackend) send(e envelope.Envelope) {
+	data, err := envelope.Encode(e)
+	if err != nil {
+		s.logger.Error("fail to generate "+e.Table+" envelope", zap.Error(err), zap.String("policy", s.policyName))
+		return
+	}
+	s.pusher <- data
+}
+
+func (s *suzieqBackend) countRecords(table string, count int) {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	s.tableCounts[table] += int64(count)
+}
+
+func (s *suzieqBackend) pushPollErrors(changes []backend.PollError) {
+	s.countRecords(PollErrors, len(changes))
+	run := s.nextRun()
+	s.push(PollErrors, changes, &run, nil)
+}
+
+func (s *suzieqBackend) nextRun() envelope.Run {
+	s.sequence++
+	return envelope.Run{ID: s.runID, Sequence: s.sequence, Timestamp: time.Now().UTC()}
+}
+
+// completeRun pushes the record that closes the current run, listing every
+// forwarded table with the amount of records pushed for it. It is only sent
+// when sq-poller finished successfully, so the receiver never treats an
+// interrupted run as a full snapshot
+func (s *suzieqBackend) completeRun(proc *cmd.Cmd) {
+	status := proc.Status()
+	if status.Error != nil || !status.Complete || status.Exit != 0 {
+		s.delta.endRun(false)
+		s.logger.Warn("suzieq run did not complete, skipping run completion", zap.String("run", s.runID),
+			zap.Int("exit_code", status.Exit), zap.String("policy", s.policyName))
+		return
+	}
+	for table, keys := range s.delta.endRun(true) {
+		run := s.nextRun()
+		s.pushRemoved(table, keys, &run)
+	}
+	s.runMutex.Lock()
+	tableCounts := make(map[string]int64, len(s.tableCounts))
+	for table, count := range s.tableCounts {
+		tableCounts[table] = count
+	}
+	s.runMutex.Unlock()
+	run := s.nextRun()
+	s.push(envelope.RunCompleteTable, map[string]interface{}{"tables": tableCounts}, &run, nil)
+	s.logger.Info("suzieq run completed", zap.String("run", s.runID), zap.Any("tables", tableCounts),
+		zap.String("policy", s.policyName))
+}
+
 func (s *suzieqBackend) Stop(ctx context.Context) error {
 	s.logger.Info("routine call to stop suzieq", zap.Any("routine", ctx.Value("routine")))
-	if s.stopped {
+	s.runMutex.Lock()
+	stopped, proc, statusChan := s.stopped, s.proc, s.statusChan
+	s.runMutex.Unlock()
+	if stopped {
 		s.logger.Info("suzieq instance was already stopped", zap.String("policy", s.policyName))
 		return nil
 	}
 	defer s.cancelFunc()
-	err := s.proc.Stop()
-	finalStatus := <-s.statusChan
+	err := proc.Stop()
+	finalStatus := <-statusChan
 	if err != nil {
 		s.logger.Error("suzieq shutdown error", zap.Error(err))
 		return err
 	}
 	s.logger.Info("suzieq process stopped", zap.Int("pid", finalStatus.PID), zap.Int("exit_code", finalStatus.Exit))
+	s.runMutex.Lock()
 	s.stopped = true
+	s.runMutex.Unlock()
 	return nil
 }
 
+// FullReset makes the next run push the full tables instead of deltas
 func (s *suzieqBackend) FullReset(ctx context.Context) error {
+	s.delta.requestFull()
+	s.logger.Info("suzieq full resync requested", zap.String("policy", s.policyName))
 	return nil
 }
 
@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/orb-community/diode/agent/backend"
+	"github.com/orb-community/diode/envelope"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakePoller puts an sq-poller on the PATH that logs one vlan record and
+// exits after a while
+func fakePoller(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		`echo 'suzieq.poller.worker.writers.logging - WARNING {"vlan": [{"namespace": "ns", "hostname": "r1", "vlanName": "v10"}]}'` + "\n" +
+		"sleep 1.2\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sq-poller"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunningStatusAcrossRuns(t *testing.T) {
+	fakePoller(t)
+	name := "suzieq_test_policy"
+	t.Cleanup(func() { os.Remove("/tmp/" + name + "_inventory.yml") })
+
+	pusher := make(chan []byte, 16)
+	s := New().(*suzieqBackend)
+	assert.NoError(t, s.Configure(zap.NewNop(), name, pusher,
+		map[string]interface{}{"inventory": map[string]interface{}{}, "interval": "10ms"}, nil))
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "routine", "test"))
+	assert.NoError(t, s.Start(ctx, cancel))
+
+	// the status is polled while the output goroutine starts the next run
+	completed := false
+	deadline := time.After(3 * time.Second)
+	for !completed {
+		select {
+		case data := <-pusher:
+			envs, err := envelope.Decode(data)
+			assert.NoError(t, err)
+			for _, e := range envs {
+				completed = completed || e.Table == envelope.RunCompleteTable
+			}
+		case <-time.After(10 * time.Millisecond):
+			status, _, _ := s.GetRunningStatus()
+			assert.Equal(t, backend.Running, status)
+		case <-deadline:
+			t.Fatal("no run completed")
+		}
+	}
+	// let the next run start before stopping
+	for end := time.Now().Add(1500 * time.Millisecond); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		s.GetRunningStatus()
+	}
+	assert.NoError(t, s.Stop(ctx))
+}
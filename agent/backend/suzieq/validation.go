@@ -0,0 +1,298 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-cmd/cmd"
+	"github.com/orb-community/diode/agent/backend"
+	"github.com/orb-community/diode/envelope"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+// suzieq-cli tables supporting the assert verb
+var Assertions = [...]string{"interface", "bgp", "ospf", "evpnVni"}
+
+const (
+	Validation = envelope.ValidationTable
+
+	AssertPass = "pass"
+	AssertFail = "fail"
+
+	defaultValidationInterval = time.Hour
+)
+
+// ValidationResult is the outcome of an assertion for a single device
+type ValidationResult struct {
+	Assertion string                 `json:"assertion"`
+	Namespace string                 `json:"namespace"`
+	Hostname  string                 `json:"hostname"`
+	Result    string                 `json:"result"`
+	Reasons   []string               `json:"reasons,omitempty"`
+	Details   map[string]interface{} `json:"details"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+type suzieqValidation struct {
+	logger        *zap.Logger
+	policyName    string
+	inventoryPath string
+	namespaces    []string
+	assertions    []string
+	interval      time.Duration
+	pusher        chan []byte
+	startTime     time.Time
+	cancelFunc    context.CancelFunc
+	ctx           context.Context
+	statusMutex   sync.Mutex
+	status        backend.RunningStatus
+	lastError     string
+}
+
+var _ backend.Backend = (*suzieqValidation)(nil)
+
+func NewValidation() backend.Backend {
+	return &suzieqValidation{status: backend.Unknown, interval: defaultValidationInterval}
+}
+
+func (s *suzieqValidation) Configure(logger *zap.Logger, name string, pusher chan []byte, data map[string]interface{}, conf map[string]interface{}) error {
+	var prs bool
+	var inventory interface{}
+	if inventory, prs = data["inventory"]; !prs {
+		return errors.New("you must set suzieq inventory")
+	}
+	if inv, ok := inventory.(map[string]interface{}); ok {
+		if namespaces, ok := inv["namespaces"].([]interface{}); ok {
+			for _, n := range namespaces {
+				if namespace, ok := n.(map[string]interface{}); ok {
+					if name, ok := namespace["name"].(string); ok {
+						s.namespaces = append(s.namespaces, name)
+					}
+				}
+			}
+		}
+	}
+
+	if assertions, ok := data["assertions"].([]interface{}); ok {
+		for _, a := range assertions {
+			assertion, ok := a.(string)
+			if !ok || !slices.Contains(Assertions[:], assertion) {
+				return fmt.Errorf("suzieq assertion '%v' is not supported", a)
+			}
+			s.assertions = append(s.assertions, assertion)
+		}
+	} else {
+		s.assertions = Assertions[:]
+	}
+
+	if interval, ok := data["interval"].(string); ok {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return errors.New("suzieq validation interval must be positive")
+		}
+		s.interval = d
+	}
+
+	var err error
+	if s.inventoryPath, err = writeInventory(name, inventory); err != nil {
+		return err
+	}
+
+	s.logger = logger
+	s.policyName = name
+	s.pusher = pusher
+
+	return nil
+}
+
+func (s *suzieqValidation) Version() (string, error) {
+	return sqVersion()
+}
+
+func (s *suzieqValidation) Start(ctx context.Context, cancelFunc context.CancelFunc) error {
+	s.startTime = time.Now()
+	s.cancelFunc = cancelFunc
+	s.ctx = ctx
+	s.setStatus(backend.Running, "")
+
+	s.logger.Info("suzieq validation startup", zap.Strings("assertions", s.assertions),
+		zap.Duration("interval", s.interval), zap.String("policy", s.policyName))
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.validate()
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				s.logger.Info("suzieq validation context cancelled", zap.String("policy", s.policyName))
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// validate refreshes the suzieq parquet store of the policy inventory and
+// pushes the results of every configured assertion
+func (s *suzieqValidation) validate() {
+	pOptions := []string{
+		"-I",
+		s.inventoryPath,
+		"-o",
+		"parquet",
+		"--run-once",
+		"update",
+	}
+	status, err := s.run("sq-poller", pOptions...)
+	if err != nil {
+		s.logger.Error("suzieq validation poller error", zap.Error(err), zap.String("policy", s.policyName))
+		s.setStatus(backend.BackendError, err.Error())
+		return
+	}
+	if status.Exit != 0 {
+		errMsg := fmt.Sprintf("suzieq poller exited with code %d", status.Exit)
+		s.logger.Error("suzieq validation poller error", zap.Strings("stderr", status.Stderr), zap.String("policy", s.policyName))
+		s.setStatus(backend.BackendError, errMsg)
+		return
+	}
+
+	results := make([]ValidationResult, 0)
+	for _, assertion := range s.assertions {
+		aOptions := []string{assertion, "assert", "--format=json"}
+		if len(s.namespaces) > 0 {
+			aOptions = append(aOptions, "--namespace="+strings.Join(s.namespaces, " "))
+		}
+		status, err := s.run("suzieq-cli", aOptions...)
+		if err != nil {
+			s.logger.Error("suzieq assertion error", zap.String("assertion", assertion), zap.Error(err), zap.String("policy", s.policyName))
+			continue
+		}
+		r, err := parseAssertOutput(assertion, strings.Join(status.Stdout, "\n"))
+		if err != nil {
+			s.logger.Error("suzieq assertion output error", zap.String("assertion", assertion), zap.Error(err), zap.String("policy", s.policyName))
+			continue
+		}
+		results = append(results, r...)
+	}
+	s.setStatus(backend.Running, "")
+
+	failed := 0
+	for _, r := range results {
+		if r.Result != AssertPass {
+			failed++
+		}
+	}
+	s.logger.Info("suzieq validation completed", zap.Int("results", len(results)), zap.Int("failed", failed),
+		zap.String("policy", s.policyName))
+
+	e, err := envelope.New(s.policyName, BackendName, Validation, results)
+	if err != nil {
+		s.logger.Error("fail to generate validation results", zap.Error(err), zap.String("policy", s.policyName))
+		return
+	}
+	validationData, err := envelope.Encode(e)
+	if err != nil {
+		s.logger.Error("fail to generate validation results", zap.Error(err), zap.String("policy", s.policyName))
+		return
+	}
+	s.pusher <- validationData
+}
+
+func (s *suzieqValidation) run(name string, args ...string) (cmd.Status, error) {
+	c := cmd.NewCmd(name, args...)
+	select {
+	case status := <-c.Start():
+		return status, status.Error
+	case <-s.ctx.Done():
+		c.Stop()
+		return cmd.Status{}, s.ctx.Err()
+	}
+}
+
+func parseAssertOutput(assertion string, output string) ([]ValidationResult, error) {
+	if len(strings.TrimSpace(output)) == 0 {
+		return nil, nil
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &records); err != nil {
+		return nil, err
+	}
+	results := make([]ValidationResult, 0, len(records))
+	for _, r := range records {
+		result := ValidationResult{Assertion: assertion, Details: r, Timestamp: time.Now().UTC()}
+		result.Namespace, _ = r["namespace"].(string)
+		result.Hostname, _ = r["hostname"].(string)
+		result.Result, _ = r["assert"].(string)
+		if ts, ok := r["timestamp"].(float64); ok {
+			result.Timestamp = time.UnixMilli(int64(ts)).UTC()
+		}
+		switch reason := r["assertReason"].(type) {
+		case string:
+			if reason != "-" && len(reason) > 0 {
+				result.Reasons = []string{reason}
+			}
+		case []interface{}:
+			for _, v := range reason {
+				result.Reasons = append(result.Reasons, fmt.Sprint(v))
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *suzieqValidation) setStatus(status backend.RunningStatus, errMsg string) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	s.status = status
+	s.lastError = errMsg
+}
+
+func (s *suzieqValidation) Stop(ctx context.Context) error {
+	s.logger.Info("routine call to stop suzieq validation", zap.Any("routine", ctx.Value("routine")))
+	s.setStatus(backend.Offline, "")
+	s.cancelFunc()
+	return nil
+}
+
+func (s *suzieqValidation) FullReset(ctx context.Context) error {
+	return nil
+}
+
+func (s *suzieqValidation) GetStartTime() time.Time {
+	return s.startTime
+}
+
+func (s *suzieqValidation) GetCapabilities() (map[string]interface{}, error) {
+	jsonBody := make(map[string]interface{})
+	return jsonBody, nil
+}
+
+func (s *suzieqValidation) GetRunningStatus() (backend.RunningStatus, string, error) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+	if s.status == backend.BackendError {
+		return s.status, s.lastError, errors.New(s.lastError)
+	}
+	return s.status, "", nil
+}
+
+func (s *suzieqValidation) GetPollErrors() []backend.PollError {
+	return []backend.PollError{}
+}
@@ -0,0 +1,89 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package suzieq
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseAssertOutput(t *testing.T) {
+	cases := []struct {
+		name    string
+		output  string
+		results int
+		result  string
+		reasons []string
+		err     bool
+	}{
+		{name: "empty output", output: "  \n", results: 0},
+		{name: "no records", output: "[]", results: 0},
+		{name: "passed", output: `[{"namespace":"ns","hostname":"r1","assert":"pass","assertReason":"-"}]`,
+			results: 1, result: AssertPass},
+		{name: "string reason", output: `[{"namespace":"ns","hostname":"r1","assert":"fail","assertReason":"mtu mismatch"}]`,
+			results: 1, result: AssertFail, reasons: []string{"mtu mismatch"}},
+		{name: "list reason", output: `[{"namespace":"ns","hostname":"r1","assert":"fail","assertReason":["peer down", 2]}]`,
+			results: 1, result: AssertFail, reasons: []string{"peer down", "2"}},
+		{name: "empty reason", output: `[{"namespace":"ns","hostname":"r1","assert":"fail","assertReason":""}]`,
+			results: 1, result: AssertFail},
+		{name: "invalid output", output: "Traceback (most recent call last):", err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			results, err := parseAssertOutput("interface", c.output)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, results, c.results)
+			if c.results == 0 {
+				return
+			}
+			assert.Equal(t, "interface", results[0].Assertion)
+			assert.Equal(t, "ns", results[0].Namespace)
+			assert.Equal(t, "r1", results[0].Hostname)
+			assert.Equal(t, c.result, results[0].Result)
+			assert.Equal(t, c.reasons, results[0].Reasons)
+		})
+	}
+
+	results, err := parseAssertOutput("bgp", `[{"hostname":"r1","assert":"pass","timestamp":1684000000000}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, time.UnixMilli(1684000000000).UTC(), results[0].Timestamp)
+}
+
+func TestValidationConfigure(t *testing.T) {
+	inventory := map[string]interface{}{"namespaces": []interface{}{map[string]interface{}{"name": "ns1"}}}
+	name := "validation_test_policy"
+	t.Cleanup(func() { os.Remove("/tmp/" + name + "_inventory.yml") })
+
+	s := NewValidation().(*suzieqValidation)
+	err := s.Configure(zap.NewNop(), name, nil, map[string]interface{}{"inventory": inventory}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Assertions[:], s.assertions)
+	assert.Equal(t, defaultValidationInterval, s.interval)
+	assert.Equal(t, []string{"ns1"}, s.namespaces)
+
+	s = NewValidation().(*suzieqValidation)
+	err = s.Configure(zap.NewNop(), name, nil, map[string]interface{}{"inventory": inventory,
+		"assertions": []interface{}{"bgp"}, "interval": "15m"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bgp"}, s.assertions)
+	assert.Equal(t, 15*time.Minute, s.interval)
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"inventory": inventory, "assertions": []interface{}{"routes"}},
+		{"inventory": inventory, "interval": "-1m"},
+		{"inventory": inventory, "interval": "hourly"},
+	} {
+		assert.Error(t, NewValidation().Configure(zap.NewNop(), name, nil, data, nil), "data %v", data)
+	}
+}
@@ -7,9 +7,11 @@ package config
 import "time"
 
 type Status struct {
-	StartTime time.Time     `json:"start_time"`
-	UpTime    time.Duration `json:"up_time"`
-	Version   string        `json:"version"`
+	StartTime time.Time         `json:"start_time"`
+	UpTime    time.Duration     `json:"up_time"`
+	Version   string            `json:"version"`
+	AgentID   string            `json:"agent_id"`
+	Tags      map[string]string `json:"tags,omitempty"`
 }
 
 type Policy struct {
@@ -17,15 +19,95 @@ type Policy struct {
 	Backend string                 `mapstructure:"backend"`
 	Config  map[string]interface{} `mapstructure:"config"`
 	Data    map[string]interface{} `mapstructure:"data"`
+	Outputs []string               `mapstructure:"outputs"`
+}
+
+type QueueConfig struct {
+	Type                 string        `mapstructure:"type"`
+	Path                 string        `mapstructure:"path"`
+	MaxSize              int64         `mapstructure:"max_size"`
+	RetryInitialInterval time.Duration `mapstructure:"retry_initial_interval"`
+	RetryMaxInterval     time.Duration `mapstructure:"retry_max_interval"`
+}
+
+type TLSConfig struct {
+	Insecure           bool   `mapstructure:"insecure"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+}
+
+type KafkaSaslConfig struct {
+	Mechanism string `mapstructure:"mechanism"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+type KafkaConfig struct {
+	Brokers         []string        `mapstructure:"brokers"`
+	Topic           string          `mapstructure:"topic"`
+	MetricsTopic    string          `mapstructure:"metrics_topic"`
+	ProtocolVersion string          `mapstructure:"protocol_version"`
+	ClientID        string          `mapstructure:"client_id"`
+	RequiredAcks    int16           `mapstructure:"required_acks"`
+	Sasl            KafkaSaslConfig `mapstructure:"sasl"`
+}
+
+type SigningConfig struct {
+	Algorithm string `mapstructure:"algorithm"`
+	KeyID     string `mapstructure:"key_id"`
+	KeyFile   string `mapstructure:"key_file"`
+}
+
+type FileConfig struct {
+	Format         string        `mapstructure:"format"`
+	Prefix         string        `mapstructure:"prefix"`
+	MaxSize        int64         `mapstructure:"max_size"`
+	RotateInterval time.Duration `mapstructure:"rotate_interval"`
+	Compress       bool          `mapstructure:"compress"`
+	MaxFiles       int           `mapstructure:"max_files"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+}
+
+type BatchConfig struct {
+	Timeout           time.Duration `mapstructure:"timeout"`
+	SendBatchSize     int           `mapstructure:"send_batch_size"`
+	SendBatchMaxBytes int64         `mapstructure:"send_batch_max_bytes"`
+}
+
+type OutputConfig struct {
+	Type        string            `mapstructure:"type"`
+	Path        string            `mapstructure:"path"`
+	Auth        string            `mapstructure:"auth"`
+	Headers     map[string]string `mapstructure:"headers"`
+	Compression string            `mapstructure:"compression"`
+	Encoding    string            `mapstructure:"encoding"`
+	TLS         TLSConfig         `mapstructure:"tls"`
+	Kafka       KafkaConfig       `mapstructure:"kafka"`
+	Batch       BatchConfig       `mapstructure:"batch"`
+	File        FileConfig        `mapstructure:"file"`
 }
 
 type DiodeConfig struct {
-	Debug      bool   `mapstructure:"debug"`
-	OutputType string `mapstructure:"output_type"`
-	OutputPath string `mapstructure:"output_path"`
-	OutputAuth string `mapstructure:"output_auth"`
-	Host       string `mapstructure:"host"`
-	Port       string `mapstructure:"port"`
+	Debug       bool                    `mapstructure:"debug"`
+	OutputType  string                  `mapstructure:"output_type"`
+	OutputPath  string                  `mapstructure:"output_path"`
+	OutputAuth  string                  `mapstructure:"output_auth"`
+	Headers     map[string]string       `mapstructure:"headers"`
+	Compression string                  `mapstructure:"compression"`
+	Encoding    string                  `mapstructure:"encoding"`
+	TLS         TLSConfig               `mapstructure:"tls"`
+	Host        string                  `mapstructure:"host"`
+	Port        string                  `mapstructure:"port"`
+	StateDir    string                  `mapstructure:"state_dir"`
+	Queue       QueueConfig             `mapstructure:"queue"`
+	Signing     SigningConfig           `mapstructure:"signing"`
+	Kafka       KafkaConfig             `mapstructure:"kafka"`
+	Batch       BatchConfig             `mapstructure:"batch"`
+	File        FileConfig              `mapstructure:"file"`
+	Outputs     map[string]OutputConfig `mapstructure:"outputs"`
 }
 
 type DiodeAgent struct {
@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const agentIDFile = "agent_id"
+
+// resolveStateDir returns the configured state dir, defaulting to ~/.diode
+func resolveStateDir(stateDir string) (string, error) {
+	if stateDir != "" {
+		return stateDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Join(errors.New("no state_dir set and fail to find home directory"), err)
+	}
+	return filepath.Join(home, ".diode"), nil
+}
+
+// loadAgentID returns the agent id persisted in the state dir, generating
+// and persisting a new one on the first start
+func loadAgentID(logger *zap.Logger, stateDir string) (string, error) {
+	path := filepath.Join(stateDir, agentIDFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", errors.Join(errors.New("fail to read agent id from '"+path+"'"), err)
+	}
+
+	id := uuid.NewString()
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return "", errors.Join(errors.New("fail to create state dir '"+stateDir+"'"), err)
+	}
+	if err := os.WriteFile(path+".tmp", []byte(id+"\n"), 0644); err != nil {
+		return "", errors.Join(errors.New("fail to persist agent id"), err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return "", errors.Join(errors.New("fail to persist agent id"), err)
+	}
+	logger.Info("generated new agent id", zap.String("agent_id", id), zap.String("path", path))
+	return id, nil
+}
@@ -0,0 +1,111 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"context"
+	"sort"
+
+	"github.com/orb-community/diode/envelope"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.uber.org/zap"
+)
+
+const (
+	policyAttribute  = "diode.policy"
+	backendAttribute = "diode.backend"
+	agentAttribute   = "diode.agent_id"
+	tagAttribute     = "diode.tag."
+)
+
+// batchOutput is implemented by outputs able to export several queued
+// payloads in a single request
+type batchOutput interface {
+	output
+	sendBatch(ctx context.Context, items [][]byte) error
+}
+
+// otlpBatch groups payloads into one ResourceLogs per policy, with the
+// policy, backend, agent id and agent tags as resource attributes
+type otlpBatch struct {
+	logger  *zap.Logger
+	logs    plog.Logs
+	records map[string]plog.LogRecordSlice
+	metrics pmetric.Metrics
+}
+
+func newOtlpBatch(logger *zap.Logger) *otlpBatch {
+	return &otlpBatch{logger: logger, logs: plog.NewLogs(),
+		records: make(map[string]plog.LogRecordSlice), metrics: pmetric.NewMetrics()}
+}
+
+// add converts the payload, returning an error when it can never be exported
+func (b *otlpBatch) add(data []byte) error {
+	metrics, ok, err := toMetrics(data)
+	if err != nil {
+		return err
+	}
+	if ok {
+		metrics.ResourceMetrics().MoveAndAppendTo(b.metrics.ResourceMetrics())
+		return nil
+	}
+	return b.addLogs(data)
+}
+
+func (b *otlpBatch) addLogs(data []byte) error {
+	envelopes, err := envelope.Decode(data)
+	if err != nil {
+		return err
+	}
+	policy := envelopes[0].Policy
+	records, ok := b.records[policy]
+	if !ok {
+		res := b.logs.ResourceLogs().AppendEmpty()
+		setResourceAttributes(res.Resource().Attributes(), envelopes[0])
+		scope := res.ScopeLogs().AppendEmpty()
+		scope.Scope().SetName(policy)
+		records = scope.LogRecords()
+		b.records[policy] = records
+	}
+	record := records.AppendEmpty()
+	record.SetSeverityNumber(plog.SeverityNumberTrace)
+	return record.Body().FromRaw(data)
+}
+
+// addAll adds every payload, dropping the ones that can not be converted
+func (b *otlpBatch) addAll(items [][]byte) {
+	for _, data := range items {
+		if err := b.add(data); err != nil {
+			b.logger.Error("pusher - fail to convert payload, dropping it", zap.Error(err))
+		}
+	}
+}
+
+func setResourceAttributes(attrs pcommon.Map, env envelope.Envelope) {
+	attrs.PutStr(policyAttribute, env.Policy)
+	if env.Backend != "" {
+		attrs.PutStr(backendAttribute, env.Backend)
+	}
+	if env.AgentID != "" {
+		attrs.PutStr(agentAttribute, env.AgentID)
+	}
+	keys := make([]string, 0, len(env.Tags))
+	for k := range env.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs.PutStr(tagAttribute+k, env.Tags[k])
+	}
+}
+
+// toLogs wraps the payload in a log record, scoped by the policy name
+func toLogs(data []byte) (plog.Logs, error) {
+	b := newOtlpBatch(nil)
+	err := b.addLogs(data)
+	return b.logs, err
+}
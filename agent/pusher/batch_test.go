@@ -0,0 +1,131 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orb-community/diode/agent/config"
+	"github.com/orb-community/diode/envelope"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// recordingOutput reports every request it receives, as the payloads it holds
+type recordingOutput struct {
+	sent chan [][]byte
+}
+
+func (o *recordingOutput) start(ctx context.Context) error { return nil }
+func (o *recordingOutput) stop(ctx context.Context) error  { return nil }
+
+func (o *recordingOutput) send(ctx context.Context, data []byte) error {
+	o.sent <- [][]byte{data}
+	return nil
+}
+
+func (o *recordingOutput) sendBatch(ctx context.Context, items [][]byte) error {
+	o.sent <- items
+	return nil
+}
+
+func startWorker(t *testing.T, batch config.BatchConfig) (*outputWorker, *recordingOutput) {
+	out := &recordingOutput{sent: make(chan [][]byte, 10)}
+	w := newOutputWorker(zap.NewNop(), "test", config.OutputConfig{Type: Otlp, Batch: batch}, out,
+		newMemoryQueue(defaultQueueMaxSize), config.QueueConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go w.deliver(ctx)
+	return w, out
+}
+
+func receive(t *testing.T, out *recordingOutput, timeout time.Duration) [][]byte {
+	select {
+	case items := <-out.sent:
+		return items
+	case <-time.After(timeout):
+		t.Fatal("no request sent")
+		return nil
+	}
+}
+
+func TestBatchSentOnceFull(t *testing.T) {
+	w, out := startWorker(t, config.BatchConfig{Timeout: time.Hour, SendBatchSize: 3})
+
+	w.enqueue([]byte("1"))
+	w.enqueue([]byte("2"))
+	select {
+	case <-out.sent:
+		t.Fatal("batch sent before being full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	w.enqueue([]byte("3"))
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, receive(t, out, time.Second))
+
+	// a fourth payload starts a new batch
+	w.enqueue([]byte("4"))
+	select {
+	case <-out.sent:
+		t.Fatal("batch sent before being full")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBatchSentOnTimeout(t *testing.T) {
+	w, out := startWorker(t, config.BatchConfig{Timeout: 200 * time.Millisecond, SendBatchSize: 10})
+
+	start := time.Now()
+	w.enqueue([]byte("1"))
+	w.enqueue([]byte("2"))
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, receive(t, out, 2*time.Second))
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+}
+
+func TestBatchMaxBytes(t *testing.T) {
+	w, out := startWorker(t, config.BatchConfig{Timeout: time.Hour, SendBatchSize: 10, SendBatchMaxBytes: 5})
+
+	// both payloads do not fit in one request, the first is sent without
+	// waiting for the batch timeout
+	w.enqueue([]byte("aaa"))
+	w.enqueue([]byte("bbb"))
+	assert.Equal(t, [][]byte{[]byte("aaa")}, receive(t, out, time.Second))
+}
+
+func TestOtlpBatchRouting(t *testing.T) {
+	discovery := func(policy string, tags map[string]string) []byte {
+		e, err := envelope.New(policy, "suzieq", "interfaces", []interface{}{})
+		assert.NoError(t, err)
+		e.AgentID = "agent-1"
+		e.Tags = tags
+		data, err := envelope.Encode(e)
+		assert.NoError(t, err)
+		return data
+	}
+
+	b := newOtlpBatch(zap.NewNop())
+	b.addAll([][]byte{
+		discovery("p1", map[string]string{"site": "dc1"}),
+		discovery("p2", nil),
+		discovery("p1", map[string]string{"site": "dc1"}),
+		encodeEnvelope(t, "ifCounters", []interface{}{map[string]interface{}{"hostname": "r1", "ifname": "eth0"}}),
+		[]byte("not json"),
+	})
+
+	// metric tables go to the metrics, discovery tables to one resource per policy
+	assert.Equal(t, 1, b.metrics.ResourceMetrics().Len())
+	assert.Equal(t, 2, b.logs.ResourceLogs().Len())
+	assert.Equal(t, 3, b.logs.LogRecordCount())
+	attrs := b.logs.ResourceLogs().At(0).Resource().Attributes()
+	policy, _ := attrs.Get(policyAttribute)
+	assert.Equal(t, "p1", policy.Str())
+	agent, _ := attrs.Get(agentAttribute)
+	assert.Equal(t, "agent-1", agent.Str())
+	site, _ := attrs.Get(tagAttribute + "site")
+	assert.Equal(t, "dc1", site.Str())
+	assert.Equal(t, 2, b.logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().Len())
+}
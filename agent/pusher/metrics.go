@@ -0,0 +1,105 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/orb-community/diode/envelope"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+type metricConverter func(scope pmetric.ScopeMetrics, data json.RawMessage) error
+
+// discovery tables exported as otlp metrics instead of logs
+var metricConverters = map[string]metricConverter{
+	"ifCounters": ifCountersToMetrics,
+}
+
+type ifCounters struct {
+	Namespace string  `json:"namespace"`
+	Hostname  string  `json:"hostname"`
+	Ifname    string  `json:"ifname"`
+	RxBytes   float64 `json:"rxBytes"`
+	TxBytes   float64 `json:"txBytes"`
+	RxErrors  float64 `json:"rxErrors"`
+	TxErrors  float64 `json:"txErrors"`
+	RxDrops   float64 `json:"rxDrops"`
+	TxDrops   float64 `json:"txDrops"`
+	Timestamp float64 `json:"timestamp"`
+}
+
+// toMetrics converts a discovery payload holding metric tables into otlp
+// metrics, reporting false when the payload must be exported as logs
+func toMetrics(data []byte) (pmetric.Metrics, bool, error) {
+	metrics := pmetric.NewMetrics()
+	envelopes, err := envelope.Decode(data)
+	if err != nil {
+		return metrics, false, err
+	}
+	found := false
+	for _, env := range envelopes {
+		convert, ok := metricConverters[env.Table]
+		if !ok {
+			continue
+		}
+		found = true
+		res := metrics.ResourceMetrics().AppendEmpty()
+		setResourceAttributes(res.Resource().Attributes(), env)
+		scope := res.ScopeMetrics().AppendEmpty()
+		scope.Scope().SetName(env.Policy)
+		if err := convert(scope, env.Records); err != nil {
+			return metrics, true, err
+		}
+	}
+	return metrics, found, nil
+}
+
+func ifCountersToMetrics(scope pmetric.ScopeMetrics, data json.RawMessage) error {
+	var records []ifCounters
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	io := newSum(scope, "interface.io", "Bytes received and transmitted by the interface", "By")
+	errs := newSum(scope, "interface.errors", "Errors received and transmitted by the interface", "{error}")
+	drops := newSum(scope, "interface.dropped", "Packets dropped on receive and transmit by the interface", "{packet}")
+	now := pcommon.NewTimestampFromTime(time.Now())
+	for _, r := range records {
+		ts := now
+		if r.Timestamp > 0 {
+			ts = pcommon.NewTimestampFromTime(time.UnixMilli(int64(r.Timestamp)))
+		}
+		addInterfacePoint(io, &r, ts, "receive", r.RxBytes)
+		addInterfacePoint(io, &r, ts, "transmit", r.TxBytes)
+		addInterfacePoint(errs, &r, ts, "receive", r.RxErrors)
+		addInterfacePoint(errs, &r, ts, "transmit", r.TxErrors)
+		addInterfacePoint(drops, &r, ts, "receive", r.RxDrops)
+		addInterfacePoint(drops, &r, ts, "transmit", r.TxDrops)
+	}
+	return nil
+}
+
+func newSum(scope pmetric.ScopeMetrics, name, description, unit string) pmetric.Sum {
+	metric := scope.Metrics().AppendEmpty()
+	metric.SetName(name)
+	metric.SetDescription(description)
+	metric.SetUnit(unit)
+	sum := metric.SetEmptySum()
+	sum.SetIsMonotonic(true)
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	return sum
+}
+
+func addInterfacePoint(sum pmetric.Sum, r *ifCounters, ts pcommon.Timestamp, direction string, value float64) {
+	dp := sum.DataPoints().AppendEmpty()
+	dp.SetTimestamp(ts)
+	dp.SetIntValue(int64(value))
+	dp.Attributes().PutStr("namespace", r.Namespace)
+	dp.Attributes().PutStr("device", r.Hostname)
+	dp.Attributes().PutStr("interface", r.Ifname)
+	dp.Attributes().PutStr("direction", direction)
+}
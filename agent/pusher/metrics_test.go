@@ -0,0 +1,61 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"testing"
+
+	"github.com/orb-community/diode/envelope"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func encodeEnvelope(t *testing.T, table string, records interface{}) []byte {
+	e, err := envelope.New("policy", "suzieq", table, records)
+	assert.NoError(t, err)
+	data, err := envelope.Encode(e)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestIfCountersToMetrics(t *testing.T) {
+	data := encodeEnvelope(t, "ifCounters", []interface{}{map[string]interface{}{
+		"namespace": "ns", "hostname": "r1", "ifname": "eth0", "rxBytes": 100, "txBytes": 200,
+		"rxErrors": 1, "txErrors": 2, "rxDrops": 3, "txDrops": 4, "timestamp": 1684000000000,
+	}})
+
+	metrics, ok, err := toMetrics(data)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, metrics.ResourceMetrics().Len())
+	res := metrics.ResourceMetrics().At(0)
+	policy, _ := res.Resource().Attributes().Get(policyAttribute)
+	assert.Equal(t, "policy", policy.Str())
+
+	ms := res.ScopeMetrics().At(0).Metrics()
+	assert.Equal(t, 3, ms.Len())
+	io := ms.At(0)
+	assert.Equal(t, "interface.io", io.Name())
+	assert.Equal(t, pmetric.MetricTypeSum, io.Type())
+	points := io.Sum().DataPoints()
+	assert.Equal(t, 2, points.Len())
+	assert.Equal(t, int64(100), points.At(0).IntValue())
+	assert.Equal(t, int64(200), points.At(1).IntValue())
+	direction, _ := points.At(1).Attributes().Get("direction")
+	assert.Equal(t, "transmit", direction.Str())
+	device, _ := points.At(0).Attributes().Get("device")
+	assert.Equal(t, "r1", device.Str())
+	assert.Equal(t, int64(1684000000000), points.At(0).Timestamp().AsTime().UnixMilli())
+}
+
+func TestToMetricsDiscoveryTable(t *testing.T) {
+	metrics, ok, err := toMetrics(encodeEnvelope(t, "interfaces", []interface{}{}))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, metrics.MetricCount())
+
+	_, _, err = toMetrics([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"context"
+	"errors"
+
+	"github.com/orb-community/diode/agent/config"
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+// output delivers queued payloads to their destination. A failed send is
+// retried with the same payload, unless the error is permanent
+type output interface {
+	start(ctx context.Context) error
+	send(ctx context.Context, data []byte) error
+	stop(ctx context.Context) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanent(err error) bool {
+	var pErr permanentError
+	return errors.As(err, &pErr)
+}
+
+func tlsClientSetting(c config.TLSConfig) (configtls.TLSClientSetting, error) {
+	if c.Insecure && (c.CAFile != "" || c.CertFile != "" || c.KeyFile != "") {
+		return configtls.TLSClientSetting{}, errors.New("tls certificates are set but tls.insecure is enabled")
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return configtls.TLSClientSetting{}, errors.New("tls.cert_file and tls.key_file must be set together")
+	}
+	return configtls.TLSClientSetting{
+		TLSSetting: configtls.TLSSetting{
+			CAFile:   c.CAFile,
+			CertFile: c.CertFile,
+			KeyFile:  c.KeyFile,
+		},
+		Insecure:           c.Insecure,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+	}, nil
+}
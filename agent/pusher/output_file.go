@@ -0,0 +1,276 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orb-community/diode/agent/config"
+	"github.com/orb-community/diode/envelope"
+	"go.uber.org/zap"
+)
+
+const (
+	// FileFormatRaw writes every payload to its own file
+	FileFormatRaw = "raw"
+	// FileFormatNdjson appends one envelope per line to rotating files
+	FileFormatNdjson = "ndjson"
+
+	defaultFilePrefix         = "diode"
+	defaultFileMaxSize        = 64 * 1024 * 1024
+	defaultFileRotateInterval = time.Hour
+
+	ndjsonSuffix = ".ndjson"
+	gzipSuffix   = ".gz"
+	// sortable timestamp of the rotated files
+	rotatedLayout = "20060102T150405.000000000Z"
+)
+
+type fileOutput struct {
+	logger     *zap.Logger
+	outputPath string
+	fc         config.FileConfig
+	mutex      sync.Mutex
+	file       *os.File
+	size       int64
+	opened     time.Time
+	cancelFunc context.CancelFunc
+	done       chan struct{}
+}
+
+var _ output = (*fileOutput)(nil)
+
+func newFileOutput(logger *zap.Logger, oc config.OutputConfig) (*fileOutput, error) {
+	if _, err := os.Stat(oc.Path); os.IsNotExist(err) {
+		return nil, errors.New("output path '" + oc.Path + "' does not exist")
+	}
+	fc := oc.File
+	switch fc.Format {
+	case "":
+		fc.Format = FileFormatRaw
+	case FileFormatRaw, FileFormatNdjson:
+	default:
+		return nil, errors.New(fc.Format + " is a invalid file format")
+	}
+	if fc.Prefix == "" {
+		fc.Prefix = defaultFilePrefix
+	}
+	if fc.MaxSize <= 0 {
+		fc.MaxSize = defaultFileMaxSize
+	}
+	if fc.RotateInterval <= 0 {
+		fc.RotateInterval = defaultFileRotateInterval
+	}
+	return &fileOutput{logger: logger, outputPath: oc.Path, fc: fc}, nil
+}
+
+func (o *fileOutput) start(ctx context.Context) error {
+	if o.fc.Format != FileFormatNdjson {
+		return nil
+	}
+	o.prune()
+	ctx, o.cancelFunc = context.WithCancel(ctx)
+	o.done = make(chan struct{})
+	go o.rotateOnInterval(ctx)
+	return nil
+}
+
+func (o *fileOutput) send(ctx context.Context, data []byte) error {
+	envelopes, err := envelope.Decode(data)
+	if err != nil {
+		return permanentError{err}
+	}
+	if o.fc.Format != FileFormatNdjson {
+		path := o.outputPath + "/" + envelopes[0].Policy + "_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		return os.WriteFile(path, data, 0644)
+	}
+
+	// one envelope per line, each one carrying its policy, table and run.
+	// Signed payloads are kept as is, so their signature can still be checked
+	var lines bytes.Buffer
+	if _, signed, _ := envelope.Unwrap(data); signed {
+		lines.Write(bytes.TrimSpace(data))
+		lines.WriteByte('\n')
+	} else {
+		for _, e := range envelopes {
+			line, err := envelope.Encode(e)
+			if err != nil {
+				return permanentError{err}
+			}
+			lines.Write(line)
+			lines.WriteByte('\n')
+		}
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.size > 0 && o.size+int64(lines.Len()) > o.fc.MaxSize {
+		o.rotate()
+	}
+	if o.file == nil {
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	n, err := o.file.Write(lines.Bytes())
+	o.size += int64(n)
+	return err
+}
+
+func (o *fileOutput) stop(ctx context.Context) error {
+	if o.cancelFunc != nil {
+		o.cancelFunc()
+		<-o.done
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	// the active file is appended to again on the next start
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+func (o *fileOutput) activePath() string {
+	return filepath.Join(o.outputPath, o.fc.Prefix+ndjsonSuffix)
+}
+
+func (o *fileOutput) open() error {
+	f, err := os.OpenFile(o.activePath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Join(errors.New("fail to open output file"), err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Join(errors.New("fail to open output file"), err)
+	}
+	o.file = f
+	o.size = info.Size()
+	o.opened = time.Now()
+	return nil
+}
+
+func (o *fileOutput) rotateOnInterval(ctx context.Context) {
+	defer close(o.done)
+	tick := o.fc.RotateInterval
+	if tick > time.Minute {
+		tick = time.Minute
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.mutex.Lock()
+			if o.file != nil && o.size > 0 && time.Since(o.opened) >= o.fc.RotateInterval {
+				o.rotate()
+			}
+			o.mutex.Unlock()
+		}
+	}
+}
+
+// rotate closes the active file and archives it under a timestamped name,
+// the next send opens a new one. It must be called with the mutex held
+func (o *fileOutput) rotate() {
+	if o.file != nil {
+		if err := o.file.Close(); err != nil {
+			o.logger.Warn("fail to close output file", zap.Error(err))
+		}
+		o.file = nil
+	}
+	o.size = 0
+	rotated := filepath.Join(o.outputPath, o.fc.Prefix+"-"+time.Now().UTC().Format(rotatedLayout)+ndjsonSuffix)
+	if err := os.Rename(o.activePath(), rotated); err != nil {
+		o.logger.Error("fail to rotate output file", zap.Error(err))
+		return
+	}
+	if o.fc.Compress {
+		if err := gzipFile(rotated); err != nil {
+			o.logger.Error("fail to compress rotated output file, keeping it uncompressed", zap.String("path", rotated),
+				zap.Error(err))
+		}
+	}
+	o.prune()
+}
+
+// prune removes the rotated files beyond max_files or older than max_age
+func (o *fileOutput) prune() {
+	entries, err := os.ReadDir(o.outputPath)
+	if err != nil {
+		o.logger.Error("fail to list output files", zap.Error(err))
+		return
+	}
+	var rotated []os.DirEntry
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, o.fc.Prefix+"-") {
+			continue
+		}
+		if strings.HasSuffix(name, ndjsonSuffix) || strings.HasSuffix(name, ndjsonSuffix+gzipSuffix) {
+			rotated = append(rotated, e)
+		}
+	}
+	// newest first, the timestamp in the name sorts them
+	sort.Slice(rotated, func(i, j int) bool { return rotated[i].Name() > rotated[j].Name() })
+	for i, e := range rotated {
+		expired := o.fc.MaxFiles > 0 && i >= o.fc.MaxFiles
+		if !expired && o.fc.MaxAge > 0 {
+			if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > o.fc.MaxAge {
+				expired = true
+			}
+		}
+		if !expired {
+			continue
+		}
+		if err := os.Remove(filepath.Join(o.outputPath, e.Name())); err != nil {
+			o.logger.Warn("fail to remove expired output file", zap.String("file", e.Name()), zap.Error(err))
+		}
+	}
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + gzipSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+gzipSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
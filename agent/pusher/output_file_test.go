@@ -0,0 +1,67 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/orb-community/diode/agent/config"
+	"github.com/orb-community/diode/envelope"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFileOutputNdjsonRotation(t *testing.T) {
+	dir := t.TempDir()
+	o, err := newFileOutput(zap.NewNop(), config.OutputConfig{Path: dir,
+		File: config.FileConfig{Format: FileFormatNdjson, MaxSize: 300, Compress: true, MaxFiles: 2}})
+	assert.NoError(t, err)
+	assert.NoError(t, o.start(context.Background()))
+
+	data := []byte(`{"schema_version":2,"policy":"policy_1","backend":"suzieq","table":"device",` +
+		`"run":{"id":"abc","sequence":1,"timestamp":"2026-10-19T00:00:00Z"},"records":[{"hostname":"h1"}]}`)
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, o.send(context.Background(), data))
+	}
+	assert.True(t, isPermanent(o.send(context.Background(), []byte("not json"))))
+	assert.NoError(t, o.stop(context.Background()))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	// the active file plus the two newest rotated ones
+	assert.Len(t, names, 3)
+	assert.Equal(t, "diode.ndjson", names[2])
+	assert.Regexp(t, `^diode-.*\.ndjson\.gz$`, names[0])
+
+	f, err := os.Open(filepath.Join(dir, names[0]))
+	assert.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	scanner := bufio.NewScanner(zr)
+	lines := 0
+	for scanner.Scan() {
+		envelopes, err := envelope.Decode(scanner.Bytes())
+		assert.NoError(t, err)
+		assert.Equal(t, "device", envelopes[0].Table)
+		assert.Equal(t, "abc", envelopes[0].Run.ID)
+		lines++
+	}
+	assert.Positive(t, lines)
+
+	_, err = newFileOutput(zap.NewNop(), config.OutputConfig{Path: dir, File: config.FileConfig{Format: "csv"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/orb-community/diode/agent/config"
+	"go.uber.org/zap"
+)
+
+const httpTimeout = 30 * time.Second
+
+type httpOutput struct {
+	logger     *zap.Logger
+	outputPath string
+	outputAuth string
+	headers    map[string]string
+	client     *http.Client
+}
+
+var _ output = (*httpOutput)(nil)
+
+func newHttpOutput(logger *zap.Logger, c config.OutputConfig) (*httpOutput, error) {
+	tlsSetting, err := tlsClientSetting(c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := tlsSetting.LoadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &httpOutput{logger: logger, outputPath: c.Path, outputAuth: c.Auth, headers: c.Headers,
+		client: &http.Client{Timeout: httpTimeout, Transport: transport}}, nil
+}
+
+func (o *httpOutput) start(ctx context.Context) error {
+	return nil
+}
+
+func (o *httpOutput) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", o.outputPath, bytes.NewBuffer(data))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Add("Content-Type", "application/json")
+	for k, v := range o.headers {
+		req.Header.Set(k, v)
+	}
+	if o.outputAuth != "" {
+		req.Header.Add("Authorization", o.outputAuth)
+	}
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	o.logger.Info("pusher - http response status: " + res.Status)
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("http output responded with status %s", res.Status)
+	// client errors will not be fixed by sending the same payload again
+	if res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+func (o *httpOutput) stop(ctx context.Context) error {
+	return nil
+}
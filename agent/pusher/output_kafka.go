@@ -0,0 +1,159 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/orb-community/diode/agent/config"
+	"github.com/orb-community/diode/envelope"
+	"github.com/orb-community/diode/kafkaauth"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultKafkaTopic           = "otlp_logs"
+	defaultKafkaProtocolVersion = "2.0.0"
+)
+
+// kafkaOutput publishes OTLP protobuf encoded payloads, the same encoding
+// expected by the service kafka receiver. Messages are keyed by policy name,
+// so each policy always lands on the same partition
+type kafkaOutput struct {
+	logger       *zap.Logger
+	brokers      []string
+	topic        string
+	metricsTopic string
+	saramaConfig *sarama.Config
+	newProducer  func(brokers []string, cfg *sarama.Config) (sarama.SyncProducer, error)
+	producer     sarama.SyncProducer
+}
+
+var _ output = (*kafkaOutput)(nil)
+
+func newKafkaOutput(logger *zap.Logger, c config.OutputConfig) (*kafkaOutput, error) {
+	kc := c.Kafka
+	brokers := kc.Brokers
+	if len(brokers) == 0 && c.Path != "" {
+		brokers = strings.Split(c.Path, ",")
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka output requires at least one broker")
+	}
+	topic := kc.Topic
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	protocolVersion := kc.ProtocolVersion
+	if protocolVersion == "" {
+		protocolVersion = defaultKafkaProtocolVersion
+	}
+
+	cfg := sarama.NewConfig()
+	version, err := sarama.ParseKafkaVersion(protocolVersion)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Version = version
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+	cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	if kc.RequiredAcks != 0 {
+		cfg.Producer.RequiredAcks = sarama.RequiredAcks(kc.RequiredAcks)
+	}
+	cfg.Producer.Partitioner = sarama.NewHashPartitioner
+	// retries are handled by the pusher queue
+	cfg.Producer.Retry.Max = 0
+	if kc.ClientID != "" {
+		cfg.ClientID = kc.ClientID
+	}
+	if err = kafkaauth.ConfigureSasl(cfg, kc.Sasl.Mechanism, kc.Sasl.Username, kc.Sasl.Password); err != nil {
+		return nil, err
+	}
+	tlsSetting, err := tlsClientSetting(c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if !c.TLS.Insecure {
+		tlsConfig, err := tlsSetting.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &kafkaOutput{logger: logger, brokers: brokers, topic: topic, metricsTopic: kc.MetricsTopic,
+		saramaConfig: cfg, newProducer: sarama.NewSyncProducer}, nil
+}
+
+func (o *kafkaOutput) start(ctx context.Context) error {
+	var err error
+	o.producer, err = o.newProducer(o.brokers, o.saramaConfig)
+	if err != nil {
+		o.logger.Error("pusher - fail to create kafka producer", zap.Error(err))
+	}
+	return err
+}
+
+func (o *kafkaOutput) send(ctx context.Context, data []byte) error {
+	envelopes, err := envelope.Decode(data)
+	if err != nil {
+		return permanentError{err}
+	}
+	key := envelopes[0].Policy
+
+	topic := o.topic
+	var value []byte
+	metrics, ok, err := toMetrics(data)
+	if err != nil {
+		return permanentError{err}
+	}
+	if ok {
+		if o.metricsTopic == "" {
+			return permanentError{errors.New("kafka output has no metrics topic configured")}
+		}
+		topic = o.metricsTopic
+		value, err = pmetricotlp.NewExportRequestFromMetrics(metrics).MarshalProto()
+	} else {
+		logs, lErr := toLogs(data)
+		if lErr != nil {
+			return permanentError{lErr}
+		}
+		value, err = plogotlp.NewExportRequestFromLogs(logs).MarshalProto()
+	}
+	if err != nil {
+		return permanentError{err}
+	}
+
+	partition, offset, err := o.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	})
+	if err != nil {
+		if errors.Is(err, sarama.ErrMessageSizeTooLarge) {
+			return permanentError{err}
+		}
+		return err
+	}
+	o.logger.Debug("pusher - kafka message delivered", zap.String("topic", topic),
+		zap.Int32("partition", partition), zap.Int64("offset", offset))
+	return nil
+}
+
+func (o *kafkaOutput) stop(ctx context.Context) error {
+	if o.producer != nil {
+		return o.producer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/orb-community/diode/agent/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.uber.org/zap"
+)
+
+func TestKafkaOutputSend(t *testing.T) {
+	o, err := newKafkaOutput(zap.NewNop(), config.OutputConfig{
+		TLS:   config.TLSConfig{Insecure: true},
+		Kafka: config.KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "diode", RequiredAcks: 1},
+	})
+	assert.NoError(t, err)
+
+	var producer *mocks.SyncProducer
+	o.newProducer = func(brokers []string, cfg *sarama.Config) (sarama.SyncProducer, error) {
+		producer = mocks.NewSyncProducer(t, cfg)
+		return producer, nil
+	}
+	assert.NoError(t, o.start(context.Background()))
+
+	data := []byte(`{"schema_version":1,"agent_id":"agent_1","tags":{"site":"lab"},` +
+		`"policy":"policy_1","backend":"suzieq","table":"device","records":[]}`)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "diode", msg.Topic)
+		key, err := msg.Key.Encode()
+		assert.NoError(t, err)
+		assert.Equal(t, "policy_1", string(key))
+		value, err := msg.Value.Encode()
+		assert.NoError(t, err)
+		req := plogotlp.NewExportRequest()
+		assert.NoError(t, req.UnmarshalProto(value))
+		res := req.Logs().ResourceLogs().At(0)
+		assert.Equal(t, "policy_1", res.ScopeLogs().At(0).Scope().Name())
+		backend, _ := res.Resource().Attributes().Get("diode.backend")
+		assert.Equal(t, "suzieq", backend.Str())
+		agentID, _ := res.Resource().Attributes().Get("diode.agent_id")
+		assert.Equal(t, "agent_1", agentID.Str())
+		tag, _ := res.Resource().Attributes().Get("diode.tag.site")
+		assert.Equal(t, "lab", tag.Str())
+		return nil
+	})
+	assert.NoError(t, o.send(context.Background(), data))
+
+	producer.ExpectSendMessageAndFail(sarama.ErrNotEnoughReplicas)
+	err = o.send(context.Background(), data)
+	assert.Error(t, err)
+	assert.False(t, isPermanent(err))
+
+	assert.True(t, isPermanent(o.send(context.Background(), []byte("not json"))))
+	assert.NoError(t, o.stop(context.Background()))
+}
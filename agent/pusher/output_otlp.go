@@ -0,0 +1,165 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"context"
+	"errors"
+
+	"github.com/orb-community/diode/agent/config"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/otlpexporter"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+var compressionTypes = []configcompression.CompressionType{
+	configcompression.Gzip,
+	configcompression.Zlib,
+	configcompression.Deflate,
+	configcompression.Snappy,
+	configcompression.Zstd,
+	"none",
+	"",
+}
+
+type otlpOutput struct {
+	logger      *zap.Logger
+	outputPath  string
+	headers     map[string]configopaque.String
+	compression configcompression.CompressionType
+	tls         configtls.TLSClientSetting
+	lexporter   exporter.Logs
+	mexporter   exporter.Metrics
+}
+
+var _ batchOutput = (*otlpOutput)(nil)
+
+func newOtlpOutput(logger *zap.Logger, c config.OutputConfig) (*otlpOutput, error) {
+	tls, headers, compression, err := otlpClientSettings(logger, c)
+	if err != nil {
+		return nil, err
+	}
+	return &otlpOutput{logger: logger, outputPath: c.Path, headers: headers, compression: compression, tls: tls}, nil
+}
+
+// otlpClientSettings validates the tls, headers and compression shared by the otlp outputs
+func otlpClientSettings(logger *zap.Logger, c config.OutputConfig) (configtls.TLSClientSetting,
+	map[string]configopaque.String, configcompression.CompressionType, error) {
+	tls, err := tlsClientSetting(c.TLS)
+	if err != nil {
+		return tls, nil, "", err
+	}
+	compression := configcompression.CompressionType(c.Compression)
+	if !slices.Contains(compressionTypes, compression) {
+		return tls, nil, "", errors.New("unsupported otlp compression '" + c.Compression + "'")
+	}
+	headers := make(map[string]configopaque.String, len(c.Headers)+1)
+	for k, v := range c.Headers {
+		headers[k] = configopaque.String(v)
+	}
+	if c.Auth != "" {
+		headers["Authorization"] = configopaque.String(c.Auth)
+	}
+	if c.TLS.Insecure && len(headers) > 0 {
+		logger.Warn("pusher - otlp output headers will be sent without tls")
+	}
+	return tls, headers, compression, nil
+}
+
+func (o *otlpOutput) start(ctx context.Context) error {
+	factory := otlpexporter.NewFactory()
+	set := exporter.CreateSettings{
+		TelemetrySettings: component.TelemetrySettings{
+			Logger:         o.logger,
+			TracerProvider: trace.NewNoopTracerProvider(),
+		},
+	}
+	cfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
+	cfg.GRPCClientSettings.Endpoint = o.outputPath
+	cfg.GRPCClientSettings.TLSSetting = o.tls
+	cfg.GRPCClientSettings.Headers = o.headers
+	if o.compression != "" {
+		cfg.GRPCClientSettings.Compression = o.compression
+	}
+	// queueing and retries are handled by the pusher, so exports must fail synchronously
+	cfg.QueueSettings.Enabled = false
+	cfg.RetrySettings.Enabled = false
+
+	var err error
+	o.lexporter, err = factory.CreateLogsExporter(ctx, set, cfg)
+	if err != nil {
+		o.logger.Error("pusher - fail to create log exporter", zap.Error(err))
+		return err
+	}
+	err = o.lexporter.Start(ctx, nil)
+	if err != nil {
+		o.logger.Error("pusher - fail to start log exporter", zap.Error(err))
+		return err
+	}
+	o.mexporter, err = factory.CreateMetricsExporter(ctx, set, cfg)
+	if err != nil {
+		o.logger.Error("pusher - fail to create metrics exporter", zap.Error(err))
+		return err
+	}
+	err = o.mexporter.Start(ctx, nil)
+	if err != nil {
+		o.logger.Error("pusher - fail to start metrics exporter", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (o *otlpOutput) send(ctx context.Context, data []byte) error {
+	b := newOtlpBatch(o.logger)
+	if err := b.add(data); err != nil {
+		return permanentError{err}
+	}
+	return o.export(ctx, b)
+}
+
+func (o *otlpOutput) sendBatch(ctx context.Context, items [][]byte) error {
+	b := newOtlpBatch(o.logger)
+	b.addAll(items)
+	return o.export(ctx, b)
+}
+
+func (o *otlpOutput) export(ctx context.Context, b *otlpBatch) error {
+	if b.logs.LogRecordCount() > 0 {
+		if err := o.exportError(o.lexporter.ConsumeLogs(ctx, b.logs)); err != nil {
+			return err
+		}
+	}
+	if b.metrics.DataPointCount() > 0 {
+		return o.exportError(o.mexporter.ConsumeMetrics(ctx, b.metrics))
+	}
+	return nil
+}
+
+func (o *otlpOutput) exportError(err error) error {
+	if err != nil && consumererror.IsPermanent(err) {
+		return permanentError{err}
+	}
+	return err
+}
+
+func (o *otlpOutput) stop(ctx context.Context) error {
+	var err error
+	if o.lexporter != nil {
+		err = o.lexporter.Shutdown(ctx)
+	}
+	if o.mexporter != nil {
+		if mErr := o.mexporter.Shutdown(ctx); mErr != nil {
+			err = mErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/orb-community/diode/agent/config"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configcompression"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/zap"
+)
+
+const (
+	ProtoEncoding = "proto"
+	JsonEncoding  = "json"
+
+	logsPath    = "/v1/logs"
+	metricsPath = "/v1/metrics"
+
+	maxResponseBody = 64 * 1024
+)
+
+// otlpHttpOutput exports the same records as the otlp output, over OTLP/HTTP
+type otlpHttpOutput struct {
+	logger   *zap.Logger
+	settings confighttp.HTTPClientSettings
+	encoding string
+	client   *http.Client
+}
+
+var _ batchOutput = (*otlpHttpOutput)(nil)
+
+func newOtlpHttpOutput(logger *zap.Logger, c config.OutputConfig) (*otlpHttpOutput, error) {
+	tls, headers, compression, err := otlpClientSettings(logger, c)
+	if err != nil {
+		return nil, err
+	}
+	encoding := c.Encoding
+	if encoding == "" {
+		encoding = ProtoEncoding
+	}
+	if encoding != ProtoEncoding && encoding != JsonEncoding {
+		return nil, errors.New("unsupported otlphttp encoding '" + c.Encoding + "'")
+	}
+	settings := confighttp.NewDefaultHTTPClientSettings()
+	settings.Endpoint = strings.TrimSuffix(c.Path, "/")
+	settings.TLSSetting = tls
+	settings.Headers = headers
+	settings.Compression = compression
+	if compression == "" {
+		settings.Compression = configcompression.Gzip
+	}
+	settings.Timeout = httpTimeout
+	return &otlpHttpOutput{logger: logger, settings: settings, encoding: encoding}, nil
+}
+
+func (o *otlpHttpOutput) start(ctx context.Context) error {
+	var err error
+	o.client, err = o.settings.ToClient(nil, component.TelemetrySettings{Logger: o.logger})
+	if err != nil {
+		o.logger.Error("pusher - fail to create otlphttp client", zap.Error(err))
+	}
+	return err
+}
+
+func (o *otlpHttpOutput) send(ctx context.Context, data []byte) error {
+	b := newOtlpBatch(o.logger)
+	if err := b.add(data); err != nil {
+		return permanentError{err}
+	}
+	return o.export(ctx, b)
+}
+
+func (o *otlpHttpOutput) sendBatch(ctx context.Context, items [][]byte) error {
+	b := newOtlpBatch(o.logger)
+	b.addAll(items)
+	return o.export(ctx, b)
+}
+
+func (o *otlpHttpOutput) export(ctx context.Context, b *otlpBatch) error {
+	if b.logs.LogRecordCount() > 0 {
+		req := plogotlp.NewExportRequestFromLogs(b.logs)
+		var body []byte
+		var err error
+		if o.encoding == JsonEncoding {
+			body, err = req.MarshalJSON()
+		} else {
+			body, err = req.MarshalProto()
+		}
+		if err != nil {
+			return permanentError{err}
+		}
+		if err = o.post(ctx, o.settings.Endpoint+logsPath, body); err != nil {
+			return err
+		}
+	}
+	if b.metrics.DataPointCount() > 0 {
+		req := pmetricotlp.NewExportRequestFromMetrics(b.metrics)
+		var body []byte
+		var err error
+		if o.encoding == JsonEncoding {
+			body, err = req.MarshalJSON()
+		} else {
+			body, err = req.MarshalProto()
+		}
+		if err != nil {
+			return permanentError{err}
+		}
+		return o.post(ctx, o.settings.Endpoint+metricsPath, body)
+	}
+	return nil
+}
+
+func (o *otlpHttpOutput) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	if o.encoding == JsonEncoding {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseBody))
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("otlphttp output responded with status %s", res.Status)
+	// retryable statuses as defined by the OTLP/HTTP specification
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+	return permanentError{err}
+}
+
+func (o *otlpHttpOutput) stop(ctx context.Context) error {
+	if o.client != nil {
+		o.client.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"testing"
+
+	"github.com/orb-community/diode/agent/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestOutputsUseTLSByDefault(t *testing.T) {
+	legacy, err := newOtlpHttpOutput(zap.NewNop(), legacyOutput(config.DiodeConfig{
+		OutputType: OtlpHttp, OutputPath: "https://collector:4318"}))
+	assert.NoError(t, err)
+	named, err := newOtlpHttpOutput(zap.NewNop(), config.OutputConfig{Type: OtlpHttp, Path: "https://collector:4318"})
+	assert.NoError(t, err)
+	assert.False(t, named.settings.TLSSetting.Insecure)
+	assert.Equal(t, named.settings, legacy.settings)
+	assert.Equal(t, named.encoding, legacy.encoding)
+
+	_, err = tlsClientSetting(config.TLSConfig{Insecure: true, CAFile: "/opt/diode/ca.pem"})
+	assert.Error(t, err)
+	plain, err := tlsClientSetting(config.TLSConfig{Insecure: true})
+	assert.NoError(t, err)
+	assert.True(t, plain.Insecure)
+}
@@ -5,42 +5,64 @@
 package pusher
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
-	"net/http"
-	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/orb-community/diode/agent/config"
-	"go.opentelemetry.io/collector/component"
-	"go.opentelemetry.io/collector/config/configtls"
-	"go.opentelemetry.io/collector/exporter"
-	"go.opentelemetry.io/collector/exporter/otlpexporter"
-	"go.opentelemetry.io/collector/pdata/plog"
-	"go.opentelemetry.io/otel/trace"
+	"github.com/orb-community/diode/envelope"
 	"go.uber.org/zap"
 )
 
 const (
-	File = "file"
-	Otlp = "otlp"
-	Http = "http"
+	File     = "file"
+	Otlp     = "otlp"
+	OtlpHttp = "otlphttp"
+	Http     = "http"
+	Kafka    = "kafka"
+)
+
+// queue types
+const (
+	QueueDisk   = "disk"
+	QueueMemory = "memory"
+)
+
+const (
+	// DefaultOutput is the name given to the output set by the output_* settings
+	DefaultOutput = "default"
+
+	// defaultQueueDir is where the queues are kept under the state dir
+	defaultQueueDir             = "queue"
+	defaultQueueMaxSize         = 64 * 1024 * 1024
+	defaultRetryInitialInterval = time.Second
+	defaultRetryMaxInterval     = 5 * time.Minute
+	defaultBatchTimeout         = time.Second
+	defaultBatchSize            = 256
+	// stay under the 4MiB default grpc message limit of the receivers
+	defaultBatchMaxBytes = 3 * 1024 * 1024
 )
 
 type Pusher interface {
 	GetChannel() chan []byte
+	// SetPolicyOutputs routes the policy payloads to the named outputs, or to all of them when empty
+	SetPolicyOutputs(policy string, outputs []string) error
+	RemovePolicy(policy string)
 	Start(ctx context.Context, cancelFunc context.CancelFunc) error
 	Stop(ctx context.Context)
 }
 
 type pusherImpl struct {
 	logger     *zap.Logger
-	outputPath string
-	outputType string
-	outputAuth string
+	agentID    string
+	tags       map[string]string
+	signer     *signer
+	outputs    map[string]*outputWorker
+	routes     map[string][]string
+	mutex      sync.RWMutex
 	channel    chan []byte
 	cancelFunc context.CancelFunc
 	ctx        context.Context
@@ -48,155 +70,367 @@ type pusherImpl struct {
 
 var _ Pusher = (*pusherImpl)(nil)
 
-func New(logger *zap.Logger, c config.Config) (Pusher, error) {
-	if c.DiodeAgent.DiodeConfig.OutputType == File {
-		if _, err := os.Stat(c.DiodeAgent.DiodeConfig.OutputPath); os.IsNotExist(err) {
-			return nil, errors.New("output path '" + c.DiodeAgent.DiodeConfig.OutputPath + "' does not exist")
+func New(logger *zap.Logger, c config.Config, agentID string) (Pusher, error) {
+	dc := c.DiodeAgent.DiodeConfig
+	outputs := dc.Outputs
+	queueDir := dc.Queue.Path
+	if queueDir == "" {
+		queueDir = filepath.Join(dc.StateDir, defaultQueueDir)
+	}
+	queuePath := func(name string) string {
+		return filepath.Join(queueDir, name)
+	}
+	if len(outputs) == 0 {
+		outputs = map[string]config.OutputConfig{DefaultOutput: legacyOutput(dc)}
+		// keep the queue location used before named outputs existed
+		queuePath = func(name string) string {
+			return queueDir
 		}
 	}
-	return &pusherImpl{logger: logger, outputType: c.DiodeAgent.DiodeConfig.OutputType, outputPath: c.DiodeAgent.DiodeConfig.OutputPath,
-		outputAuth: c.DiodeAgent.DiodeConfig.OutputAuth, channel: make(chan []byte, 16)}, nil
+
+	p := &pusherImpl{logger: logger, agentID: agentID, tags: c.DiodeAgent.Tags,
+		outputs: make(map[string]*outputWorker, len(outputs)), routes: make(map[string][]string), channel: make(chan []byte, 16)}
+	if dc.Signing.Algorithm != "" {
+		keyID := dc.Signing.KeyID
+		if keyID == "" {
+			keyID = agentID
+		}
+		sg, err := newSigner(dc.Signing.Algorithm, keyID, dc.Signing.KeyFile)
+		if err != nil {
+			return nil, errors.Join(errors.New("fail to set up payload signing"), err)
+		}
+		p.signer = sg
+	}
+	for name, oc := range outputs {
+		out, err := newOutput(logger, oc)
+		if err != nil {
+			return nil, errors.Join(errors.New("fail to create output '"+name+"'"), err)
+		}
+		q, err := newQueue(logger, dc.Queue, queuePath(name))
+		if err != nil {
+			return nil, errors.Join(errors.New("fail to open queue of output '"+name+"'"), err)
+		}
+		p.outputs[name] = newOutputWorker(logger, name, oc, out, q, dc.Queue)
+	}
+	for name, policy := range c.DiodeAgent.Policies {
+		if err := p.SetPolicyOutputs(name, policy.Outputs); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
 }
 
-func (s *pusherImpl) GetChannel() chan []byte {
-	return s.channel
+func legacyOutput(dc config.DiodeConfig) config.OutputConfig {
+	return config.OutputConfig{
+		Type:        dc.OutputType,
+		Path:        dc.OutputPath,
+		Auth:        dc.OutputAuth,
+		Headers:     dc.Headers,
+		Compression: dc.Compression,
+		Encoding:    dc.Encoding,
+		TLS:         dc.TLS,
+		Kafka:       dc.Kafka,
+		Batch:       dc.Batch,
+		File:        dc.File,
+	}
 }
 
-func (s *pusherImpl) Start(ctx context.Context, cancelFunc context.CancelFunc) error {
-	s.cancelFunc = cancelFunc
-	s.ctx = ctx
-	switch o := s.outputType; o {
+func newOutput(logger *zap.Logger, oc config.OutputConfig) (output, error) {
+	switch oc.Type {
 	case File:
-		return s.scrapeToFile()
+		return newFileOutput(logger, oc)
 	case Http:
-		return s.scrapeToHttp()
+		return newHttpOutput(logger, oc)
 	case Otlp:
-		return s.scrapeToOtlp()
+		return newOtlpOutput(logger, oc)
+	case OtlpHttp:
+		return newOtlpHttpOutput(logger, oc)
+	case Kafka:
+		return newKafkaOutput(logger, oc)
 	default:
-		return errors.New(s.outputType + " is a invalid output type")
+		return nil, errors.New(oc.Type + " is a invalid output type")
 	}
 }
 
-func (s *pusherImpl) Stop(ctx context.Context) {
-	s.logger.Info("routine call to stop pusher", zap.Any("routine", ctx.Value("routine")))
-	defer s.cancelFunc()
+func newQueue(logger *zap.Logger, qc config.QueueConfig, path string) (queue, error) {
+	maxSize := qc.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultQueueMaxSize
+	}
+	switch qc.Type {
+	case QueueMemory:
+		return newMemoryQueue(maxSize), nil
+	case "", QueueDisk:
+	default:
+		return nil, errors.New(qc.Type + " is a invalid queue type")
+	}
+	dq, err := newDiskQueue(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if dq.len() > 0 {
+		logger.Info("pusher - recovered pending payloads from queue", zap.String("path", path), zap.Int("pending", dq.len()))
+	}
+	return dq, nil
 }
 
-func (s *pusherImpl) scrapeToHttp() error {
-	go func() {
-		for {
-			select {
-			case data := <-s.channel:
-				client := &http.Client{}
-				req, err := http.NewRequest("POST", s.outputPath, bytes.NewBuffer(data))
-				if err != nil {
-					s.logger.Error("pusher - fail to create http request", zap.Error(err))
-					continue
-				}
-				req.Header.Add("Content-Type", "application/json")
-				if s.outputAuth != "" {
-					req.Header.Add("Authorization", s.outputAuth)
-				}
+func (s *pusherImpl) GetChannel() chan []byte {
+	return s.channel
+}
 
-				res, err := client.Do(req)
-				if err != nil {
-					s.logger.Error("pusher - fail to create http request", zap.Error(err))
-					continue
-				}
-				defer res.Body.Close()
-				s.logger.Info("pusher - http response status: " + res.Status)
-			case <-s.ctx.Done():
-				close(s.channel)
-				s.logger.Info("pusher context cancelled")
-				return
-			}
+func (s *pusherImpl) SetPolicyOutputs(policy string, outputs []string) error {
+	for _, name := range outputs {
+		if _, ok := s.outputs[name]; !ok {
+			return errors.New("policy '" + policy + "' uses unknown output '" + name + "'")
 		}
-	}()
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(outputs) == 0 {
+		delete(s.routes, policy)
+	} else {
+		s.routes[policy] = outputs
+	}
 	return nil
 }
 
-func (s *pusherImpl) scrapeToFile() error {
-	go func() {
-		for {
-			select {
-			case data := <-s.channel:
-				var jsonData map[string]interface{}
-				err := json.Unmarshal(data, &jsonData)
-				if err != nil {
-					s.logger.Error("pusher - fail to unmarshal json", zap.Error(err))
-					break
-				}
-				for policy := range jsonData {
-					path := s.outputPath + "/" + policy + "_" + strconv.FormatInt(time.Now().UnixNano(), 10)
-					if err := os.WriteFile(path, data, 0644); err != nil {
-						s.logger.Error("pusher - fail to generate output file for policy "+policy, zap.Error(err))
-						break
-					}
-				}
-			case <-s.ctx.Done():
-				close(s.channel)
-				s.logger.Info("pusher context cancelled")
-				return
-			}
+func (s *pusherImpl) RemovePolicy(policy string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.routes, policy)
+}
+
+func (s *pusherImpl) Start(ctx context.Context, cancelFunc context.CancelFunc) error {
+	s.cancelFunc = cancelFunc
+	s.ctx = ctx
+	for _, w := range s.outputs {
+		if err := w.output.start(ctx); err != nil {
+			return err
 		}
-	}()
+	}
+	for _, w := range s.outputs {
+		go w.deliver(ctx)
+	}
+	go s.route()
 	return nil
 }
 
-func (s *pusherImpl) scrapeToOtlp() error {
-	factory := otlpexporter.NewFactory()
-	factory.CreateDefaultConfig()
-	set := exporter.CreateSettings{
-		TelemetrySettings: component.TelemetrySettings{
-			Logger:         s.logger,
-			TracerProvider: trace.NewNoopTracerProvider(),
-		},
+func (s *pusherImpl) Stop(ctx context.Context) {
+	s.logger.Info("routine call to stop pusher", zap.Any("routine", ctx.Value("routine")))
+	defer s.cancelFunc()
+	for name, w := range s.outputs {
+		if err := w.output.stop(ctx); err != nil {
+			s.logger.Error("pusher - fail to stop output "+name, zap.Error(err))
+		}
 	}
-	cfg := factory.CreateDefaultConfig().(*otlpexporter.Config)
-	cfg.GRPCClientSettings.Endpoint = s.outputPath
-	cfg.GRPCClientSettings.TLSSetting = configtls.TLSClientSetting{
-		Insecure: true,
+}
+
+// route stamps every backend payload with the agent identity and queues it
+// on the outputs chosen by its policy
+func (s *pusherImpl) route() {
+	for {
+		select {
+		case data := <-s.channel:
+			data, policy := s.stamp(data)
+			data = s.sign(data, policy)
+			for _, name := range s.outputsOf(policy) {
+				s.outputs[name].enqueue(data)
+			}
+		case <-s.ctx.Done():
+			close(s.channel)
+			s.logger.Info("pusher context cancelled")
+			return
+		}
 	}
-	lexporter, err := factory.CreateLogsExporter(s.ctx, set, cfg)
+}
+
+// stamp sets the agent id and tags of the payload envelope, along with the
+// policy it belongs to. Payloads holding several envelopes are left unchanged
+func (s *pusherImpl) stamp(data []byte) ([]byte, string) {
+	envelopes, err := envelope.Decode(data)
 	if err != nil {
-		s.logger.Error("pusher - fail to create log exporter", zap.Error(err))
-		return err
+		s.logger.Warn("pusher - payload is not an envelope, forwarding it as is", zap.Error(err))
+		return data, ""
 	}
-	err = lexporter.Start(s.ctx, nil)
+	if len(envelopes) > 1 {
+		return data, envelopes[0].Policy
+	}
+	e := envelopes[0]
+	e.AgentID = s.agentID
+	e.Tags = s.tags
+	stamped, err := envelope.Encode(e)
 	if err != nil {
-		s.logger.Error("pusher - fail to start log exporter", zap.Error(err))
-		return err
+		s.logger.Error("pusher - fail to stamp payload", zap.String("policy", e.Policy), zap.Error(err))
+		return data, e.Policy
+	}
+	return stamped, e.Policy
+}
+
+// sign wraps the payload with its signature when signing is enabled
+func (s *pusherImpl) sign(data []byte, policy string) []byte {
+	if s.signer == nil {
+		return data
 	}
+	signed, err := envelope.Sign(data, s.signer.algorithm, s.signer.keyID, s.signer.key)
+	if err != nil {
+		s.logger.Error("pusher - fail to sign payload, forwarding it unsigned", zap.String("policy", policy), zap.Error(err))
+		return data
+	}
+	return signed
+}
+
+func (s *pusherImpl) outputsOf(policy string) []string {
+	s.mutex.RLock()
+	outputs, ok := s.routes[policy]
+	s.mutex.RUnlock()
+	if ok {
+		return outputs
+	}
+	all := make([]string, 0, len(s.outputs))
+	for name := range s.outputs {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// outputWorker owns the queue of a single output, so a slow or unreachable
+// output does not hold back the others
+type outputWorker struct {
+	logger               *zap.Logger
+	name                 string
+	outputType           string
+	output               output
+	queue                queue
+	retryInitialInterval time.Duration
+	retryMaxInterval     time.Duration
+	batchTimeout         time.Duration
+	batchSize            int
+	batchMaxBytes        int64
+	notify               chan struct{}
+}
+
+func newOutputWorker(logger *zap.Logger, name string, oc config.OutputConfig, out output, q queue, qc config.QueueConfig) *outputWorker {
+	w := &outputWorker{logger: logger.With(zap.String("output", name)), name: name, outputType: oc.Type,
+		output: out, queue: q, retryInitialInterval: qc.RetryInitialInterval, retryMaxInterval: qc.RetryMaxInterval,
+		batchSize: 1, notify: make(chan struct{}, 1)}
+	if w.retryInitialInterval <= 0 {
+		w.retryInitialInterval = defaultRetryInitialInterval
+	}
+	if w.retryMaxInterval < w.retryInitialInterval {
+		w.retryMaxInterval = defaultRetryMaxInterval
+	}
+	if _, ok := out.(batchOutput); ok {
+		w.batchTimeout = oc.Batch.Timeout
+		if w.batchTimeout <= 0 {
+			w.batchTimeout = defaultBatchTimeout
+		}
+		w.batchSize = oc.Batch.SendBatchSize
+		if w.batchSize <= 0 {
+			w.batchSize = defaultBatchSize
+		}
+		w.batchMaxBytes = oc.Batch.SendBatchMaxBytes
+		if w.batchMaxBytes <= 0 {
+			w.batchMaxBytes = defaultBatchMaxBytes
+		}
+	}
+	return w
+}
 
-	go func() {
-		for {
+// enqueue persists the payload before any delivery attempt
+func (w *outputWorker) enqueue(data []byte) {
+	evicted, err := w.queue.push(data)
+	if err != nil {
+		w.logger.Error("pusher - fail to queue payload", zap.Error(err))
+		return
+	}
+	if evicted > 0 {
+		w.logger.Warn("pusher - queue is full, oldest payloads were dropped", zap.Int("evicted", evicted))
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued payloads in order, retrying with exponential
+// backoff until the output accepts them. A payload is only removed from the
+// queue once it is delivered or rejected with a permanent error. Outputs
+// supporting batches wait for a full batch, or for the batch timeout since
+// the oldest pending payload, before sending
+func (w *outputWorker) deliver(ctx context.Context) {
+	backoff := w.retryInitialInterval
+	var batchStart time.Time
+	for {
+		items, err := w.queue.peekBatch(w.batchSize, w.batchMaxBytes)
+		if err != nil {
+			w.logger.Error("pusher - fail to read queued payload, dropping it", zap.Error(err))
+			w.queue.remove(items[0].id)
+			continue
+		}
+		if len(items) == 0 {
+			batchStart = time.Time{}
 			select {
-			case data := <-s.channel:
-				var pData map[string]interface{}
-				if err := json.Unmarshal(data, &pData); err != nil {
-					s.logger.Error("fail to get policy name", zap.Error(err))
-					break
-				}
-				logs := plog.NewLogs()
-				res := logs.ResourceLogs().AppendEmpty()
-				scope := res.ScopeLogs().AppendEmpty()
-				for k := range pData {
-					scope.Scope().SetName(k)
+			case <-w.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		full := len(items) >= w.batchSize || w.queue.len() > len(items)
+		if !full && w.batchTimeout > 0 {
+			if batchStart.IsZero() {
+				batchStart = time.Now()
+			}
+			if wait := w.batchTimeout - time.Since(batchStart); wait > 0 {
+				select {
+				case <-w.notify:
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
 				}
-				record := scope.LogRecords().AppendEmpty()
-				record.SetSeverityNumber(plog.SeverityNumberTrace)
-				err = record.Body().FromRaw(data)
-				if err != nil {
-					s.logger.Error("fail to add log body", zap.Error(err))
-					break
+				continue
+			}
+		}
+		batchStart = time.Time{}
+
+		err = w.send(ctx, items)
+		if err == nil || isPermanent(err) {
+			if err != nil {
+				w.logger.Error("pusher - "+w.outputType+" output rejected payload, dropping it",
+					zap.Int("payloads", len(items)), zap.Error(err))
+			}
+			for _, item := range items {
+				if err := w.queue.remove(item.id); err != nil {
+					w.logger.Error("pusher - fail to remove payload from queue", zap.Error(err))
 				}
-				lexporter.ConsumeLogs(s.ctx, logs)
-			case <-s.ctx.Done():
-				close(s.channel)
-				s.logger.Info("pusher context cancelled")
-				return
 			}
+			backoff = w.retryInitialInterval
+			continue
 		}
-	}()
-	return nil
+
+		w.logger.Warn("pusher - fail to send payload, retrying", zap.String("type", w.outputType),
+			zap.Duration("backoff", backoff), zap.Int("pending", w.queue.len()), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > w.retryMaxInterval {
+			backoff = w.retryMaxInterval
+		}
+	}
+}
+
+func (w *outputWorker) send(ctx context.Context, items []queueItem) error {
+	if len(items) == 1 {
+		return w.output.send(ctx, items[0].data)
+	}
+	data := make([][]byte, 0, len(items))
+	for _, item := range items {
+		data = append(data, item.data)
+	}
+	return w.output.(batchOutput).sendBatch(ctx, data)
 }
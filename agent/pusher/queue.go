@@ -0,0 +1,275 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentSuffix = ".seg"
+	tempSuffix    = ".tmp"
+)
+
+var errPayloadTooLarge = errors.New("payload exceeds the queue max size")
+
+type queueItem struct {
+	id   uint64
+	data []byte
+}
+
+// queue holds the payloads waiting for delivery. Items stay in the queue
+// until they are removed after a successful delivery, and the oldest items
+// are evicted once the queue grows over its max size
+type queue interface {
+	// push appends a payload, returning how many items were evicted to make room for it
+	push(data []byte) (int, error)
+	// peekBatch returns up to maxItems of the oldest items without removing them, stopping
+	// before maxBytes is exceeded unless it is the first item. When the first item can not
+	// be read, it is returned alone along with the error
+	peekBatch(maxItems int, maxBytes int64) ([]queueItem, error)
+	// remove deletes the item, unless it was already evicted
+	remove(id uint64) error
+	len() int
+}
+
+type memoryQueue struct {
+	mutex   sync.Mutex
+	items   []queueItem
+	nextID  uint64
+	size    int64
+	maxSize int64
+}
+
+var _ queue = (*memoryQueue)(nil)
+
+func newMemoryQueue(maxSize int64) *memoryQueue {
+	return &memoryQueue{maxSize: maxSize}
+}
+
+func (q *memoryQueue) push(data []byte) (int, error) {
+	if int64(len(data)) > q.maxSize {
+		return 0, errPayloadTooLarge
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	evicted := 0
+	for len(q.items) > 0 && q.size+int64(len(data)) > q.maxSize {
+		q.size -= int64(len(q.items[0].data))
+		q.items = q.items[1:]
+		evicted++
+	}
+	q.items = append(q.items, queueItem{id: q.nextID, data: data})
+	q.nextID++
+	q.size += int64(len(data))
+	return evicted, nil
+}
+
+func (q *memoryQueue) peekBatch(maxItems int, maxBytes int64) ([]queueItem, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var items []queueItem
+	var size int64
+	for _, item := range q.items {
+		if len(items) == maxItems || (len(items) > 0 && size+int64(len(item.data)) > maxBytes) {
+			break
+		}
+		items = append(items, item)
+		size += int64(len(item.data))
+	}
+	return items, nil
+}
+
+func (q *memoryQueue) remove(id uint64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.items) > 0 && q.items[0].id == id {
+		q.size -= int64(len(q.items[0].data))
+		q.items = q.items[1:]
+	}
+	return nil
+}
+
+func (q *memoryQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+type segment struct {
+	id   uint64
+	size int64
+}
+
+// diskQueue stores every payload in its own segment file, named after a
+// sequence number, so pending payloads survive agent restarts
+type diskQueue struct {
+	mutex    sync.Mutex
+	dir      string
+	segments []segment
+	nextID   uint64
+	size     int64
+	maxSize  int64
+}
+
+var _ queue = (*diskQueue)(nil)
+
+func newDiskQueue(dir string, maxSize int64) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &diskQueue{dir: dir, maxSize: maxSize}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(e.Name(), tempSuffix) {
+			// interrupted write, the payload was never acknowledged to the backend
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, segment{id: id, size: info.Size()})
+		q.size += info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].id < q.segments[j].id })
+	if len(q.segments) > 0 {
+		q.nextID = q.segments[len(q.segments)-1].id + 1
+	}
+	return q, nil
+}
+
+func (q *diskQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
+
+func (q *diskQueue) push(data []byte) (int, error) {
+	if int64(len(data)) > q.maxSize {
+		return 0, errPayloadTooLarge
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	evicted := 0
+	for len(q.segments) > 0 && q.size+int64(len(data)) > q.maxSize {
+		if err := q.removeHead(); err != nil {
+			return evicted, err
+		}
+		evicted++
+	}
+	id := q.nextID
+	path := q.segmentPath(id)
+	// the segment is synced before the rename and the dir after it, so a
+	// crash leaves either no segment or a complete one
+	if err := writeFileSync(path+tempSuffix, data); err != nil {
+		os.Remove(path + tempSuffix)
+		return evicted, err
+	}
+	if err := os.Rename(path+tempSuffix, path); err != nil {
+		os.Remove(path + tempSuffix)
+		return evicted, err
+	}
+	if err := syncDir(q.dir); err != nil {
+		os.Remove(path)
+		return evicted, err
+	}
+	q.segments = append(q.segments, segment{id: id, size: int64(len(data))})
+	q.nextID++
+	q.size += int64(len(data))
+	return evicted, nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (q *diskQueue) peekBatch(maxItems int, maxBytes int64) ([]queueItem, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var items []queueItem
+	var size int64
+	for _, seg := range q.segments {
+		if len(items) == maxItems || (len(items) > 0 && size+seg.size > maxBytes) {
+			break
+		}
+		data, err := os.ReadFile(q.segmentPath(seg.id))
+		if err != nil {
+			if len(items) == 0 {
+				return []queueItem{{id: seg.id}}, err
+			}
+			break
+		}
+		items = append(items, queueItem{id: seg.id, data: data})
+		size += seg.size
+	}
+	return items, nil
+}
+
+func (q *diskQueue) remove(id uint64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.segments) > 0 && q.segments[0].id == id {
+		return q.removeHead()
+	}
+	return nil
+}
+
+func (q *diskQueue) removeHead() error {
+	head := q.segments[0]
+	if err := os.Remove(q.segmentPath(head.id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	q.segments = q.segments[1:]
+	q.size -= head.size
+	return nil
+}
+
+func (q *diskQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.segments)
+}
@@ -0,0 +1,73 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orb-community/diode/agent/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDiskQueueRecoverAndEvict(t *testing.T) {
+	dir := t.TempDir()
+	q, err := newDiskQueue(dir, 10)
+	assert.NoError(t, err)
+
+	_, err = q.push([]byte("aaaa"))
+	assert.NoError(t, err)
+	_, err = q.push([]byte("bbbb"))
+	assert.NoError(t, err)
+	_, err = q.push([]byte("01234567890"))
+	assert.ErrorIs(t, err, errPayloadTooLarge)
+
+	// leftover from an interrupted write
+	assert.NoError(t, os.WriteFile(q.segmentPath(7)+tempSuffix, []byte("x"), 0644))
+
+	q, err = newDiskQueue(dir, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, q.len())
+
+	evicted, err := q.push([]byte("cccc"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+
+	items, err := q.peekBatch(5, 10)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, []byte("bbbb"), items[0].data)
+
+	assert.NoError(t, q.remove(items[0].id))
+	items, err = q.peekBatch(5, 2)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, []byte("cccc"), items[0].data)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestQueueDefaultsToStateDir(t *testing.T) {
+	stateDir := t.TempDir()
+	var c config.Config
+	c.DiodeAgent.DiodeConfig.StateDir = stateDir
+	c.DiodeAgent.DiodeConfig.OutputType = File
+	c.DiodeAgent.DiodeConfig.OutputPath = stateDir
+	_, err := New(zap.NewNop(), c, "agent-1")
+	assert.NoError(t, err)
+	assert.DirExists(t, filepath.Join(stateDir, defaultQueueDir))
+
+	q, err := newQueue(zap.NewNop(), config.QueueConfig{Type: QueueMemory}, filepath.Join(stateDir, "memory"))
+	assert.NoError(t, err)
+	assert.IsType(t, &memoryQueue{}, q)
+	assert.NoDirExists(t, filepath.Join(stateDir, "memory"))
+
+	_, err = newQueue(zap.NewNop(), config.QueueConfig{Type: "tape"}, stateDir)
+	assert.Error(t, err)
+}
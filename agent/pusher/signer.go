@@ -0,0 +1,44 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package pusher
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/orb-community/diode/envelope"
+)
+
+type signer struct {
+	algorithm string
+	keyID     string
+	key       []byte
+}
+
+// newSigner loads the base64 encoded signing key, the shared secret for
+// hmac-sha256 or the private key seed for ed25519
+func newSigner(algorithm string, keyID string, keyFile string) (*signer, error) {
+	if algorithm != envelope.AlgHmacSha256 && algorithm != envelope.AlgEd25519 {
+		return nil, errors.New(algorithm + " is a invalid signature algorithm")
+	}
+	if keyFile == "" {
+		return nil, errors.New("signing.key_file is required")
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.Join(errors.New("fail to read signing key"), err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.Join(errors.New("signing key must be base64 encoded"), err)
+	}
+	// check the key is usable before any payload is signed
+	if _, err := envelope.Sign([]byte("{}"), algorithm, keyID, key); err != nil {
+		return nil, err
+	}
+	return &signer{algorithm: algorithm, keyID: keyID, key: key}, nil
+}
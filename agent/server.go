@@ -22,18 +22,14 @@ type ReturnValue struct {
 	Message string `json:"message"`
 }
 
-func (a *diodeAgent) startServer(ctx context.Context) error {
-	gin.SetMode(gin.ReleaseMode)
-	a.router = gin.New()
-
-	a.router.Use(ginzap.Ginzap(a.logger, time.RFC3339, true))
-	a.router.Use(ginzap.RecoveryWithZap(a.logger, true))
+type PolicyStatus struct {
+	Status     string              `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	PollErrors []backend.PollError `json:"poll_errors"`
+}
 
-	a.router.GET("/api/v1/status", a.getStatus)
-	a.router.GET("/api/v1/policies", a.getPolicies)
-	a.router.POST("/api/v1/policies", a.createPolicy)
-	a.router.GET("/api/v1/policies/:policy", a.getPolicy)
-	a.router.DELETE("/api/v1/policies/:policy", a.deletePolicy)
+func (a *diodeAgent) startServer(ctx context.Context) error {
+	a.router = a.newRouter()
 
 	go func() {
 		a.logger.Info("starting diode-agent server at: " + a.addr)
@@ -44,6 +40,23 @@ func (a *diodeAgent) startServer(ctx context.Context) error {
 	return nil
 }
 
+func (a *diodeAgent) newRouter() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	router.Use(ginzap.Ginzap(a.logger, time.RFC3339, true))
+	router.Use(ginzap.RecoveryWithZap(a.logger, true))
+
+	router.GET("/api/v1/status", a.getStatus)
+	router.GET("/api/v1/policies", a.getPolicies)
+	router.POST("/api/v1/policies", a.createPolicy)
+	router.GET("/api/v1/policies/:policy", a.getPolicy)
+	router.GET("/api/v1/policies/:policy/status", a.getPolicyStatus)
+	router.POST("/api/v1/policies/:policy/resync", a.resyncPolicy)
+	router.DELETE("/api/v1/policies/:policy", a.deletePolicy)
+	return router
+}
+
 func (a *diodeAgent) getStatus(c *gin.Context) {
 	a.stat.UpTime = time.Since(a.stat.StartTime)
 	c.IndentedJSON(http.StatusOK, a.stat)
@@ -67,6 +80,35 @@ func (a *diodeAgent) getPolicy(c *gin.Context) {
 	}
 }
 
+func (a *diodeAgent) getPolicyStatus(c *gin.Context) {
+	policy := c.Param("policy")
+	rInfo, ok := a.policies[policy]
+	if !ok {
+		c.JSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	status, errMsg, _ := rInfo.be.GetRunningStatus()
+	c.IndentedJSON(http.StatusOK, PolicyStatus{
+		Status:     status.String(),
+		Error:      errMsg,
+		PollErrors: rInfo.be.GetPollErrors(),
+	})
+}
+
+func (a *diodeAgent) resyncPolicy(c *gin.Context) {
+	policy := c.Param("policy")
+	rInfo, ok := a.policies[policy]
+	if !ok {
+		c.JSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	if err := rInfo.be.FullReset(a.ctx); err != nil {
+		c.JSON(http.StatusForbidden, ReturnValue{err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, ReturnValue{"full resync requested for " + policy})
+}
+
 func (a *diodeAgent) createPolicy(c *gin.Context) {
 	if t := c.Request.Header.Get("Content-type"); t != "application/x-yaml" {
 		c.JSON(http.StatusForbidden, ReturnValue{"invalid Content-Type. Only 'application/x-yaml' is supported"})
@@ -100,23 +142,24 @@ func (a *diodeAgent) createPolicy(c *gin.Context) {
 		}
 	}
 
-	be, err := factory.GetBackend(data.Backend)
+	be, err := factory.GetBackend(data.Backend, data.Kind)
 	if err != nil {
 		c.JSON(http.StatusForbidden, ReturnValue{err.Error()})
 		return
 	}
-
-	if data.Kind != Kind {
-		c.JSON(http.StatusForbidden, ReturnValue{"invalid policy kind"})
+	if err = a.pusher.SetPolicyOutputs(policy, data.Outputs); err != nil {
+		c.JSON(http.StatusForbidden, ReturnValue{err.Error()})
 		return
 	}
 	if err = be.Configure(a.logger, policy, a.pusher.GetChannel(), data.Data, data.Config); err != nil {
+		a.pusher.RemovePolicy(policy)
 		c.JSON(http.StatusForbidden, ReturnValue{err.Error()})
 		return
 	}
 	backendCtx := context.WithValue(a.ctx, "routine", policy)
 
 	if err := be.Start(context.WithCancel(backendCtx)); err != nil {
+		a.pusher.RemovePolicy(policy)
 		c.JSON(http.StatusForbidden, ReturnValue{err.Error()})
 		return
 	}
@@ -140,6 +183,7 @@ func (a *diodeAgent) deletePolicy(c *gin.Context) {
 			return
 		}
 		delete(a.policies, policy)
+		a.pusher.RemovePolicy(policy)
 		c.JSON(http.StatusOK, ReturnValue{policy + " was deleted"})
 	} else {
 		c.JSON(http.StatusNotFound, ReturnValue{"policy not found"})
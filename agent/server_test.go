@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/orb-community/diode/agent/backend"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type statusBackend struct {
+	backend.Backend
+	pollErrors []backend.PollError
+}
+
+func (b *statusBackend) GetRunningStatus() (backend.RunningStatus, string, error) {
+	return backend.Running, "", nil
+}
+
+func (b *statusBackend) GetPollErrors() []backend.PollError {
+	return b.pollErrors
+}
+
+func TestGetPolicyStatus(t *testing.T) {
+	pollError := backend.PollError{Hostname: "h1", Namespace: "ns", Service: "device", Status: 401, Category: "authentication"}
+	a := &diodeAgent{logger: zap.NewNop(), policies: map[string]backendInfo{
+		"policy": {be: &statusBackend{pollErrors: []backend.PollError{pollError}}},
+	}}
+	router := a.newRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/policies/policy/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status PolicyStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, backend.Running.String(), status.Status)
+	assert.Equal(t, []backend.PollError{pollError}, status.PollErrors)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/policies/other/status", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -31,6 +31,8 @@ var (
 	Port       uint32
 )
 
+const QueueMaxSize = 64 * 1024 * 1024
+
 func Version(cmd *cobra.Command, args []string) {
 	fmt.Printf("diode-agent %s\n", buildinfo.GetVersion())
 	os.Exit(0)
@@ -126,8 +128,43 @@ func mergeOrError(path string) {
 	v.SetDefault("diode.config.output_type", OutputType)
 	v.SetDefault("diode.config.output_path", OutputPath)
 	v.SetDefault("diode.config.output_auth", "")
+	v.SetDefault("diode.config.compression", "gzip")
+	v.SetDefault("diode.config.encoding", "proto")
+	v.SetDefault("diode.config.tls.insecure", false)
+	v.SetDefault("diode.config.tls.insecure_skip_verify", false)
+	v.SetDefault("diode.config.tls.ca_file", "")
+	v.SetDefault("diode.config.tls.cert_file", "")
+	v.SetDefault("diode.config.tls.key_file", "")
+	v.SetDefault("diode.config.tls.server_name", "")
 	v.SetDefault("diode.config.host", Host)
 	v.SetDefault("diode.config.port", strconv.FormatUint(uint64(Port), 10))
+	v.SetDefault("diode.config.state_dir", "")
+	v.SetDefault("diode.config.kafka.topic", "otlp_logs")
+	v.SetDefault("diode.config.kafka.metrics_topic", "")
+	v.SetDefault("diode.config.kafka.protocol_version", "2.0.0")
+	v.SetDefault("diode.config.kafka.client_id", "")
+	v.SetDefault("diode.config.kafka.required_acks", 1)
+	v.SetDefault("diode.config.kafka.sasl.mechanism", "")
+	v.SetDefault("diode.config.kafka.sasl.username", "")
+	v.SetDefault("diode.config.kafka.sasl.password", "")
+	v.SetDefault("diode.config.batch.timeout", "1s")
+	v.SetDefault("diode.config.batch.send_batch_size", 256)
+	v.SetDefault("diode.config.batch.send_batch_max_bytes", 3*1024*1024)
+	v.SetDefault("diode.config.file.format", "raw")
+	v.SetDefault("diode.config.file.prefix", "diode")
+	v.SetDefault("diode.config.file.max_size", 64*1024*1024)
+	v.SetDefault("diode.config.file.rotate_interval", "1h")
+	v.SetDefault("diode.config.file.compress", false)
+	v.SetDefault("diode.config.file.max_files", 0)
+	v.SetDefault("diode.config.file.max_age", "0s")
+	v.SetDefault("diode.config.signing.algorithm", "")
+	v.SetDefault("diode.config.signing.key_id", "")
+	v.SetDefault("diode.config.signing.key_file", "")
+	v.SetDefault("diode.config.queue.type", "disk")
+	v.SetDefault("diode.config.queue.path", "")
+	v.SetDefault("diode.config.queue.max_size", QueueMaxSize)
+	v.SetDefault("diode.config.queue.retry_initial_interval", "1s")
+	v.SetDefault("diode.config.queue.retry_max_interval", "5m")
 
 	if len(path) > 0 {
 		cobra.CheckErr(v.ReadInConfig())
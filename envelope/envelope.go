@@ -0,0 +1,180 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package envelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// SchemaVersion is the envelope version produced by this build
+	SchemaVersion = 2
+	// MinSchemaVersion is the oldest envelope version still accepted
+	MinSchemaVersion = 0
+	// LegacySchemaVersion identifies the unversioned {"<policy>":{...}} payloads
+	// pushed by agents predating the envelope
+	LegacySchemaVersion = 0
+)
+
+// tables with a special meaning for the receiver
+const (
+	RunCompleteTable = "run_complete"
+	ValidationTable  = "validation"
+	PollErrorsTable  = "poll_errors"
+)
+
+// how the records of an envelope relate to the ones previously pushed
+const (
+	// ModeFull envelopes hold every record of the table
+	ModeFull = "full"
+	// ModeDelta envelopes only hold the records added or changed since the
+	// previous run, along with the keys of the removed ones
+	ModeDelta = "delta"
+)
+
+// legacy payload keys that are not tables
+var legacyFields = map[string]bool{"backend": true, "config": true, "run": true}
+
+var ErrUnsupportedVersion = errors.New("unsupported envelope schema version")
+
+// Envelope carries the records of a single backend table for a policy
+type Envelope struct {
+	SchemaVersion int                 `json:"schema_version"`
+	AgentID       string              `json:"agent_id,omitempty"`
+	Tags          map[string]string   `json:"tags,omitempty"`
+	Policy        string              `json:"policy"`
+	Backend       string              `json:"backend"`
+	Run           *Run                `json:"run,omitempty"`
+	Table         string              `json:"table"`
+	Mode          string              `json:"mode,omitempty"`
+	Records       json.RawMessage     `json:"records"`
+	Removed       []map[string]string `json:"removed,omitempty"`
+	Config        json.RawMessage     `json:"config,omitempty"`
+}
+
+// Run identifies the backend run an envelope belongs to
+type Run struct {
+	ID        string    `json:"id"`
+	Sequence  int64     `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// New returns an envelope of the current schema version holding the records
+func New(policy string, backend string, table string, records interface{}) (Envelope, error) {
+	raw, err := json.Marshal(records)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{SchemaVersion: SchemaVersion, Policy: policy, Backend: backend, Table: table, Records: raw}, nil
+}
+
+// Encode marshals the envelope, stamping the current schema version when unset
+func Encode(e Envelope) ([]byte, error) {
+	if e.SchemaVersion == LegacySchemaVersion {
+		e.SchemaVersion = SchemaVersion
+	}
+	if e.Policy == "" || e.Table == "" {
+		return nil, errors.New("envelope requires a policy and a table")
+	}
+	return json.Marshal(e)
+}
+
+// Negotiate checks the schema version is one this build is able to read
+func Negotiate(version int) error {
+	if version < MinSchemaVersion || version > SchemaVersion {
+		return fmt.Errorf("%w %d, supported versions are %d to %d", ErrUnsupportedVersion, version, MinSchemaVersion, SchemaVersion)
+	}
+	return nil
+}
+
+// Decode reads a payload into envelopes. Legacy payloads are converted into
+// one envelope per table, and unknown schema versions are rejected with
+// ErrUnsupportedVersion. Signed payloads are unwrapped without checking their
+// signature, see Verify
+func Decode(data []byte) ([]Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if isSigned(fields) {
+		var s Signed
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("invalid signed payload: %w", err)
+		}
+		return Decode(s.Payload)
+	}
+	rawVersion, ok := fields["schema_version"]
+	if !ok {
+		return decodeLegacy(fields)
+	}
+	var version int
+	if err := json.Unmarshal(rawVersion, &version); err != nil {
+		return nil, fmt.Errorf("invalid envelope schema version: %w", err)
+	}
+	if err := Negotiate(version); err != nil {
+		return nil, err
+	}
+	if version == LegacySchemaVersion {
+		return nil, fmt.Errorf("%w %d, legacy payloads are not versioned", ErrUnsupportedVersion, version)
+	}
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if e.Policy == "" || e.Table == "" {
+		return nil, errors.New("envelope has no policy or table")
+	}
+	return []Envelope{e}, nil
+}
+
+func decodeLegacy(fields map[string]json.RawMessage) ([]Envelope, error) {
+	if err := Negotiate(LegacySchemaVersion); err != nil {
+		return nil, err
+	}
+	policies := make([]string, 0, len(fields))
+	for policy := range fields {
+		policies = append(policies, policy)
+	}
+	sort.Strings(policies)
+
+	envelopes := make([]Envelope, 0)
+	for _, policy := range policies {
+		var entry map[string]json.RawMessage
+		if err := json.Unmarshal(fields[policy], &entry); err != nil {
+			return nil, fmt.Errorf("invalid legacy entry of policy '%s': %w", policy, err)
+		}
+		base := Envelope{SchemaVersion: LegacySchemaVersion, Policy: policy, Config: entry["config"]}
+		if b, ok := entry["backend"]; ok {
+			json.Unmarshal(b, &base.Backend)
+		}
+		if r, ok := entry["run"]; ok {
+			var run Run
+			if err := json.Unmarshal(r, &run); err == nil && run.ID != "" {
+				base.Run = &run
+			}
+		}
+		tables := make([]string, 0, len(entry))
+		for table := range entry {
+			if !legacyFields[table] {
+				tables = append(tables, table)
+			}
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			e := base
+			e.Table = table
+			e.Records = entry[table]
+			envelopes = append(envelopes, e)
+		}
+	}
+	if len(envelopes) == 0 {
+		return nil, errors.New("payload has no table")
+	}
+	return envelopes, nil
+}
@@ -0,0 +1,94 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package envelope
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	e, err := New("policy_1", "suzieq", "interfaces", []map[string]string{{"ifname": "eth0"}})
+	assert.NoError(t, err)
+	e.Run = &Run{ID: "abc", Sequence: 2, Timestamp: time.Unix(1700000000, 0).UTC()}
+
+	data, err := Encode(e)
+	assert.NoError(t, err)
+
+	envelopes, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Len(t, envelopes, 1)
+	assert.Equal(t, SchemaVersion, envelopes[0].SchemaVersion)
+	assert.Equal(t, "policy_1", envelopes[0].Policy)
+	assert.Equal(t, "interfaces", envelopes[0].Table)
+	assert.Equal(t, "abc", envelopes[0].Run.ID)
+	assert.JSONEq(t, `[{"ifname":"eth0"}]`, string(envelopes[0].Records))
+
+	_, err = Encode(Envelope{Policy: "policy_1"})
+	assert.Error(t, err)
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	data := []byte(`{"policy_1":{"backend":"suzieq","config":{"netbox":{"site":"s"}},` +
+		`"run":{"id":"abc","sequence":1},"vlan":[{"vlan":1}],"device":[{"hostname":"h"}]}}`)
+
+	envelopes, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Len(t, envelopes, 2)
+	assert.Equal(t, "device", envelopes[0].Table)
+	assert.Equal(t, "vlan", envelopes[1].Table)
+	for _, e := range envelopes {
+		assert.Equal(t, LegacySchemaVersion, e.SchemaVersion)
+		assert.Equal(t, "policy_1", e.Policy)
+		assert.Equal(t, "suzieq", e.Backend)
+		assert.Equal(t, "abc", e.Run.ID)
+		assert.JSONEq(t, `{"netbox":{"site":"s"}}`, string(e.Config))
+	}
+}
+
+func TestDecodeUnsupportedVersion(t *testing.T) {
+	_, err := Decode([]byte(`{"schema_version":99,"policy":"p","table":"vlan","records":[]}`))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	_, err = Decode([]byte(`{"schema_version":0,"policy":"p","table":"vlan","records":[]}`))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	assert.NoError(t, Negotiate(SchemaVersion))
+	assert.ErrorIs(t, Negotiate(SchemaVersion+1), ErrUnsupportedVersion)
+}
+
+func TestSignVerify(t *testing.T) {
+	payload := []byte(`{"schema_version":2,"agent_id":"agent_1","policy":"p","table":"vlan","records":[]}`)
+
+	data, err := Sign(payload, AlgHmacSha256, "k1", []byte("secret"))
+	assert.NoError(t, err)
+	s, ok, err := Unwrap(data)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "k1", s.KeyID)
+	assert.NoError(t, Verify(s, []byte("secret")))
+	assert.ErrorIs(t, Verify(s, []byte("other")), ErrInvalidSignature)
+
+	envelopes, err := Decode(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent_1", envelopes[0].AgentID)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	data, err = Sign(payload, AlgEd25519, "k2", priv.Seed())
+	assert.NoError(t, err)
+	s, _, err = Unwrap(data)
+	assert.NoError(t, err)
+	assert.NoError(t, Verify(s, pub))
+	s.Payload = []byte(`{"schema_version":2,"agent_id":"agent_2","policy":"p","table":"vlan","records":[]}`)
+	assert.ErrorIs(t, Verify(s, pub), ErrInvalidSignature)
+
+	_, ok, err = Unwrap(payload)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,101 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package envelope
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// signature algorithms
+const (
+	AlgHmacSha256 = "hmac-sha256"
+	AlgEd25519    = "ed25519"
+)
+
+var ErrInvalidSignature = errors.New("invalid payload signature")
+
+// Signed wraps a payload along with the signature of its exact bytes
+type Signed struct {
+	KeyID     string          `json:"key_id"`
+	Algorithm string          `json:"alg"`
+	Signature []byte          `json:"signature"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Sign wraps the payload with its signature. The key is the shared secret
+// for hmac-sha256, and the private key or its 32 bytes seed for ed25519
+func Sign(payload []byte, algorithm string, keyID string, key []byte) ([]byte, error) {
+	s := Signed{KeyID: keyID, Algorithm: algorithm, Payload: payload}
+	switch algorithm {
+	case AlgHmacSha256:
+		if len(key) == 0 {
+			return nil, errors.New("hmac-sha256 signing requires a key")
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(payload)
+		s.Signature = mac.Sum(nil)
+	case AlgEd25519:
+		switch len(key) {
+		case ed25519.SeedSize:
+			key = ed25519.NewKeyFromSeed(key)
+		case ed25519.PrivateKeySize:
+		default:
+			return nil, fmt.Errorf("invalid ed25519 private key size %d", len(key))
+		}
+		s.Signature = ed25519.Sign(key, payload)
+	default:
+		return nil, errors.New(algorithm + " is a invalid signature algorithm")
+	}
+	return json.Marshal(s)
+}
+
+// Verify checks the signature of the wrapped payload. The key is the shared
+// secret for hmac-sha256 and the public key for ed25519
+func Verify(s Signed, key []byte) error {
+	switch s.Algorithm {
+	case AlgHmacSha256:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(s.Payload)
+		if len(key) == 0 || !hmac.Equal(mac.Sum(nil), s.Signature) {
+			return ErrInvalidSignature
+		}
+	case AlgEd25519:
+		if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, s.Payload, s.Signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: unknown algorithm '%s'", ErrInvalidSignature, s.Algorithm)
+	}
+	return nil
+}
+
+// Unwrap returns the signed wrapper of the payload, reporting false when the
+// payload is not signed
+func Unwrap(data []byte) (Signed, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Signed{}, false, err
+	}
+	if !isSigned(fields) {
+		return Signed{}, false, nil
+	}
+	var s Signed
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Signed{}, true, fmt.Errorf("invalid signed payload: %w", err)
+	}
+	return s, true, nil
+}
+
+func isSigned(fields map[string]json.RawMessage) bool {
+	_, versioned := fields["schema_version"]
+	_, hasSignature := fields["signature"]
+	_, hasPayload := fields["payload"]
+	return !versioned && hasSignature && hasPayload
+}
@@ -0,0 +1,66 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+// Package kafkaauth configures the kafka authentication shared by the agent
+// kafka output and the service kafka receiver
+package kafkaauth
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// ConfigureSasl enables the PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 mechanism,
+// leaving sasl disabled when no mechanism is set
+func ConfigureSasl(cfg *sarama.Config, mechanism string, username string, password string) error {
+	if mechanism == "" {
+		return nil
+	}
+	cfg.Net.SASL.Enable = true
+	cfg.Net.SASL.User = username
+	cfg.Net.SASL.Password = password
+	switch mechanism {
+	case sarama.SASLTypePlaintext:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha256.New}
+		}
+	case sarama.SASLTypeSCRAMSHA512:
+		cfg.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		cfg.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha512.New}
+		}
+	default:
+		return errors.New("unsupported kafka sasl mechanism '" + mechanism + "'")
+	}
+	return nil
+}
+
+type scramClient struct {
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
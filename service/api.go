@@ -0,0 +1,126 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package service
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/orb-community/diode/service/storage"
+	"go.uber.org/zap"
+)
+
+// locateEndpoint returns the access ports an endpoint mac address was learned on
+func (ds *DiodeService) locateEndpoint(c *gin.Context) {
+	mac, err := net.ParseMAC(c.Param("mac"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ReturnValue{"invalid mac address '" + c.Param("mac") + "'"})
+		return
+	}
+	locations, err := ds.LocateEndpoint(mac.String())
+	if err != nil {
+		ds.internalError(c, err)
+		return
+	}
+	if len(locations) == 0 {
+		c.JSON(http.StatusNotFound, ReturnValue{"endpoint not found"})
+		return
+	}
+	c.JSON(http.StatusOK, locations)
+}
+
+// getDevices returns the devices discovered by the agents matching the
+// agent_id query and every tag query, set as name:value
+func (ds *DiodeService) getDevices(c *gin.Context) {
+	filter := storage.AgentFilter{AgentId: c.Query("agent_id")}
+	for _, tag := range c.QueryArray("tag") {
+		name, value, ok := strings.Cut(tag, ":")
+		if !ok || name == "" {
+			c.JSON(http.StatusBadRequest, ReturnValue{"invalid tag '" + tag + "', expected name:value"})
+			return
+		}
+		if filter.Tags == nil {
+			filter.Tags = make(map[string]string)
+		}
+		filter.Tags[name] = value
+	}
+	devices, err := ds.GetDevicesByAgent(filter)
+	if err != nil {
+		ds.internalError(c, err)
+		return
+	}
+	if devices == nil {
+		devices = []storage.DbDevice{}
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// getValidationResults returns the assertion results of a validation policy, newest first
+func (ds *DiodeService) getValidationResults(c *gin.Context) {
+	validations, err := ds.GetValidationResults(c.Param("policy"))
+	if err != nil {
+		ds.internalError(c, err)
+		return
+	}
+	if validations == nil {
+		validations = []storage.DbValidation{}
+	}
+	c.JSON(http.StatusOK, validations)
+}
+
+// getDeviceConfigs lists the running config versions of a device, which are
+// numbered per agent, the agent being selected by the agent_id query
+func (ds *DiodeService) getDeviceConfigs(c *gin.Context) {
+	devConfigs, err := ds.GetDeviceConfigs(c.Param("policy"), c.Param("namespace"), c.Param("hostname"), c.Query("agent_id"))
+	if err != nil {
+		ds.internalError(c, err)
+		return
+	}
+	if len(devConfigs) == 0 {
+		c.JSON(http.StatusNotFound, ReturnValue{"device config not found"})
+		return
+	}
+	c.JSON(http.StatusOK, devConfigs)
+}
+
+// getDeviceConfigDiff returns the unified diff of a device config version,
+// the latest one when no version query is set
+func (ds *DiodeService) getDeviceConfigDiff(c *gin.Context) {
+	policy, namespace, hostname, agentId := c.Param("policy"), c.Param("namespace"), c.Param("hostname"), c.Query("agent_id")
+	devConfigs, err := ds.GetDeviceConfigs(policy, namespace, hostname, agentId)
+	if err != nil {
+		ds.internalError(c, err)
+		return
+	}
+	if len(devConfigs) == 0 {
+		c.JSON(http.StatusNotFound, ReturnValue{"device config not found"})
+		return
+	}
+	version := devConfigs[len(devConfigs)-1].Version
+	if v := c.Query("version"); v != "" {
+		if version, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, ReturnValue{"invalid version '" + v + "'"})
+			return
+		}
+		if version < 1 || version > devConfigs[len(devConfigs)-1].Version {
+			c.JSON(http.StatusNotFound, ReturnValue{"device config version not found"})
+			return
+		}
+	}
+	diff, err := ds.GetDeviceConfigDiff(policy, namespace, hostname, agentId, version)
+	if err != nil {
+		ds.internalError(c, err)
+		return
+	}
+	c.String(http.StatusOK, diff)
+}
+
+func (ds *DiodeService) internalError(c *gin.Context, err error) {
+	ds.logger.Error("diode service api error", zap.String("path", c.FullPath()), zap.Error(err))
+	c.JSON(http.StatusInternalServerError, ReturnValue{"internal error"})
+}
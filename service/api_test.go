@@ -0,0 +1,139 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/orb-community/diode/service/config"
+	"github.com/orb-community/diode/service/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const testToken = "secret"
+
+// newTestService returns a service backed by a sqlite storage created in a
+// temporary dir, along with its api router
+func newTestService(t *testing.T) (*DiodeService, *gin.Engine) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	db, err := storage.NewSqliteStorage(zap.NewNop())
+	assert.NoError(t, err)
+	ds := &DiodeService{logger: zap.NewNop(), config: &config.Config{}, storageService: db}
+	tokens, err := parseApiTokens("read token", []string{"test:" + testToken})
+	assert.NoError(t, err)
+	return ds, ds.newRouter(nil, tokens)
+}
+
+func get(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeviceConfigRoutes(t *testing.T) {
+	ds, router := newTestService(t)
+	for _, content := range []string{"hostname r1\n", "hostname r1\nntp server a\n"} {
+		_, err := ds.storageService.Save("policy", storage.AgentInfo{Id: "agent-1"}, map[string]interface{}{"devconfig": []interface{}{
+			map[string]interface{}{"namespace": "ns", "hostname": "r1", "config": content},
+		}})
+		assert.NoError(t, err)
+	}
+
+	w := get(router, "/api/v1/device-configs/policy/ns/r1?agent_id=agent-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"version":2`)
+	assert.Equal(t, http.StatusNotFound, get(router, "/api/v1/device-configs/policy/ns/r1?agent_id=agent-2").Code)
+
+	w = get(router, "/api/v1/device-configs/policy/ns/r1/diff?agent_id=agent-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "+ntp server a")
+	w = get(router, "/api/v1/device-configs/policy/ns/r1/diff?agent_id=agent-1&version=1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "+hostname r1")
+	assert.Equal(t, http.StatusNotFound, get(router, "/api/v1/device-configs/policy/ns/r1/diff?agent_id=agent-1&version=3").Code)
+	assert.Equal(t, http.StatusBadRequest, get(router, "/api/v1/device-configs/policy/ns/r1/diff?agent_id=agent-1&version=x").Code)
+}
+
+func TestDevicesRoute(t *testing.T) {
+	ds, router := newTestService(t)
+	for _, agent := range []storage.AgentInfo{
+		{Id: "agent-1", Tags: storage.Tags{"site": "lab", "role": "core"}},
+		{Id: "agent-2", Tags: storage.Tags{"site": "dc1"}},
+	} {
+		_, err := ds.storageService.Save("policy", agent, map[string]interface{}{"device": []interface{}{
+			map[string]interface{}{"namespace": "ns", "hostname": "r1", "serialNumber": agent.Id},
+		}})
+		assert.NoError(t, err)
+	}
+
+	devices := func(path string) []storage.DbDevice {
+		w := get(router, path)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var devices []storage.DbDevice
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &devices))
+		return devices
+	}
+	assert.Len(t, devices("/api/v1/devices"), 2)
+	found := devices("/api/v1/devices?agent_id=agent-2")
+	assert.Len(t, found, 1)
+	assert.Equal(t, "agent-2", found[0].SerialNumber)
+	found = devices("/api/v1/devices?tag=site:lab&tag=role:core")
+	assert.Len(t, found, 1)
+	assert.Equal(t, "agent-1", found[0].AgentId)
+	assert.Empty(t, devices("/api/v1/devices?agent_id=agent-2&tag=site:lab"))
+	assert.Equal(t, http.StatusBadRequest, get(router, "/api/v1/devices?tag=site").Code)
+}
+
+func TestLocateEndpointRoute(t *testing.T) {
+	ds, router := newTestService(t)
+	ds.config.Base.EndpointMaxMacs = 4
+	_, err := ds.storageService.Save("policy", storage.AgentInfo{Id: "agent-1"}, map[string]interface{}{"macs": []interface{}{
+		map[string]interface{}{"namespace": "ns", "hostname": "access1", "vlan": 10, "macaddr": "00:11:22:33:44:55", "oif": "Ethernet1"},
+	}})
+	assert.NoError(t, err)
+
+	w := get(router, "/api/v1/endpoints/00-11-22-33-44-55")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var locations []storage.DbEndpointLocation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &locations))
+	assert.Len(t, locations, 1)
+	assert.Equal(t, "access1", locations[0].Hostname)
+	assert.Equal(t, "Ethernet1", locations[0].Interface)
+
+	assert.Equal(t, http.StatusNotFound, get(router, "/api/v1/endpoints/00:11:22:33:44:66").Code)
+	assert.Equal(t, http.StatusBadRequest, get(router, "/api/v1/endpoints/not-a-mac").Code)
+}
+
+func TestValidationResultsRoute(t *testing.T) {
+	ds, router := newTestService(t)
+	_, err := ds.storageService.Save("validate", storage.AgentInfo{Id: "agent-1"}, map[string]interface{}{"validation": []interface{}{
+		map[string]interface{}{"assertion": "bgp", "namespace": "ns", "hostname": "r1", "result": "fail",
+			"reasons": []string{"peer down"}, "timestamp": "2023-05-13T17:46:40Z"},
+	}})
+	assert.NoError(t, err)
+
+	w := get(router, "/api/v1/validations/validate")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var validations []storage.DbValidation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &validations))
+	assert.Len(t, validations, 1)
+	assert.Equal(t, "fail", validations[0].Result)
+	assert.Equal(t, []string{"peer down"}, validations[0].Reasons)
+
+	w = get(router, "/api/v1/validations/other")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
@@ -16,6 +16,11 @@ type BaseSvcConfig struct {
 	HttpServerCert   string `mapstructure:"server_cert"`
 	HttpServerKey    string `mapstructure:"server_key"`
 	OtlpReceiverType string `mapstructure:"otlp_receiver_type"`
+	EndpointMaxMacs  int64  `mapstructure:"endpoint_max_macs"`
+	// IngestTokens authenticate the http ingest requests, as "<name>:<token>"
+	IngestTokens []string `mapstructure:"ingest_tokens"`
+	// ReadTokens authenticate the http query requests, as "<name>:<token>"
+	ReadTokens []string `mapstructure:"read_tokens"`
 }
 
 type NetboxPusherConfig struct {
@@ -25,14 +30,36 @@ type NetboxPusherConfig struct {
 }
 
 type OtlpReceiverConfig struct {
-	Endpoint string `mapstructure:"endpoint"`
-	Protocol string `mapstructure:"protocol"`
+	Endpoint     string `mapstructure:"endpoint"`
+	Protocol     string `mapstructure:"protocol"`
+	HttpEndpoint string `mapstructure:"http_endpoint"`
+	TLSCertFile  string `mapstructure:"tls_cert_file"`
+	TLSKeyFile   string `mapstructure:"tls_key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
 }
 
 type KafkaReceiverConfig struct {
-	Brokers         []string `mapstructure:"brokers"`
-	Topic           string   `mapstructure:"topic"`
-	ProtocolVersion string   `mapstructure:"protocol_version"`
+	Brokers               []string `mapstructure:"brokers"`
+	Topic                 string   `mapstructure:"topic"`
+	ProtocolVersion       string   `mapstructure:"protocol_version"`
+	GroupID               string   `mapstructure:"group_id"`
+	ClientID              string   `mapstructure:"client_id"`
+	InitialOffset         string   `mapstructure:"initial_offset"`
+	Encoding              string   `mapstructure:"encoding"`
+	SaslMechanism         string   `mapstructure:"sasl_mechanism"`
+	SaslUsername          string   `mapstructure:"sasl_username"`
+	SaslPassword          string   `mapstructure:"sasl_password"`
+	TLS                   bool     `mapstructure:"tls"`
+	TLSCAFile             string   `mapstructure:"tls_ca_file"`
+	TLSCertFile           string   `mapstructure:"tls_cert_file"`
+	TLSKeyFile            string   `mapstructure:"tls_key_file"`
+	TLSInsecureSkipVerify bool     `mapstructure:"tls_insecure_skip_verify"`
+}
+
+type SigningConfig struct {
+	Mode          string `mapstructure:"mode"`
+	TrustedKeys   string `mapstructure:"trusted_keys"`
+	QuarantineDir string `mapstructure:"quarantine_dir"`
 }
 
 type Config struct {
@@ -40,6 +67,7 @@ type Config struct {
 	NetboxPusher  NetboxPusherConfig
 	OtlpReceiver  OtlpReceiverConfig
 	KafkaReceiver KafkaReceiverConfig
+	Signing       SigningConfig
 }
 
 const (
@@ -47,6 +75,11 @@ const (
 	otlpProtocol      = "tcp"
 	receiverType      = "otlp"
 	kafkaProtoVersion = "2.0.0"
+	kafkaClientID     = "diode-service"
+	kafkaGroupID      = "otel-collector" // group of earlier releases, resuming from their offsets
+	kafkaOffset       = "latest"
+	kafkaEncoding     = "otlp_proto"
+	endpointMaxMacs   = 4
 )
 
 func LoadConfig(prefix string) Config {
@@ -55,6 +88,7 @@ func LoadConfig(prefix string) Config {
 	config.NetboxPusher = loadNetboxPusherConfig(prefix)
 	config.OtlpReceiver = loadOtlpReceiverConfig(prefix)
 	config.KafkaReceiver = loadKafkaReceiverConfig(prefix)
+	config.Signing = loadSigningConfig(prefix)
 	return config
 }
 
@@ -67,6 +101,9 @@ func loadBaseServiceConfig(prefix string) BaseSvcConfig {
 	cfg.SetDefault("server_cert", "")
 	cfg.SetDefault("server_key", "")
 	cfg.SetDefault("otlp_receiver_type", receiverType)
+	cfg.SetDefault("endpoint_max_macs", endpointMaxMacs)
+	cfg.SetDefault("ingest_tokens", make([]string, 0))
+	cfg.SetDefault("read_tokens", make([]string, 0))
 
 	cfg.AllowEmptyEnv(true)
 	cfg.AutomaticEnv()
@@ -96,6 +133,10 @@ func loadOtlpReceiverConfig(prefix string) OtlpReceiverConfig {
 
 	cfg.SetDefault("endpoint", otlpEndpoint)
 	cfg.SetDefault("protocol", otlpProtocol)
+	cfg.SetDefault("http_endpoint", "")
+	cfg.SetDefault("tls_cert_file", "")
+	cfg.SetDefault("tls_key_file", "")
+	cfg.SetDefault("client_ca_file", "")
 
 	cfg.AllowEmptyEnv(true)
 	cfg.AutomaticEnv()
@@ -111,6 +152,18 @@ func loadKafkaReceiverConfig(prefix string) KafkaReceiverConfig {
 	cfg.SetDefault("topic", "otlp_logs")
 	cfg.SetDefault("brokers", make([]string, 0))
 	cfg.SetDefault("protocol_version", kafkaProtoVersion)
+	cfg.SetDefault("group_id", kafkaGroupID)
+	cfg.SetDefault("client_id", kafkaClientID)
+	cfg.SetDefault("initial_offset", kafkaOffset)
+	cfg.SetDefault("encoding", kafkaEncoding)
+	cfg.SetDefault("sasl_mechanism", "")
+	cfg.SetDefault("sasl_username", "")
+	cfg.SetDefault("sasl_password", "")
+	cfg.SetDefault("tls", false)
+	cfg.SetDefault("tls_ca_file", "")
+	cfg.SetDefault("tls_cert_file", "")
+	cfg.SetDefault("tls_key_file", "")
+	cfg.SetDefault("tls_insecure_skip_verify", false)
 
 	cfg.AllowEmptyEnv(true)
 	cfg.AutomaticEnv()
@@ -118,3 +171,18 @@ func loadKafkaReceiverConfig(prefix string) KafkaReceiverConfig {
 	cfg.Unmarshal(&kafkaC)
 	return kafkaC
 }
+
+func loadSigningConfig(prefix string) SigningConfig {
+	cfg := viper.New()
+	cfg.SetEnvPrefix(fmt.Sprintf("%s_signing", prefix))
+
+	cfg.SetDefault("mode", "off")
+	cfg.SetDefault("trusted_keys", "")
+	cfg.SetDefault("quarantine_dir", "")
+
+	cfg.AllowEmptyEnv(true)
+	cfg.AutomaticEnv()
+	var signingC SigningConfig
+	cfg.Unmarshal(&signingC)
+	return signingC
+}
@@ -31,7 +31,14 @@ type Pusher interface {
 	UpdateDevice(int64, int64, string) (int64, error)
 	CreateInterface([]byte) (int64, error)
 	CreateInterfaceIpAddress([]byte, NetboxPrimaryIpChecker) (int64, error)
+	CreateEndpointIpAddress([]byte) (int64, error)
 	CreateInventory([]byte) (int64, error)
+	CreateCable([]byte) (int64, error)
+	CreatePrefix([]byte) (int64, error)
+	GetPrefix([]byte) (int64, error)
+	GetAsn(int64) (int64, error)
+	CreateBgpSession([]byte) (int64, error)
+	CreateJournalEntry([]byte) (int64, error)
 	PrimaryIpCheck(string, int64, NetboxPrimaryIpChecker) (int64, error)
 }
 
@@ -45,10 +52,12 @@ type NetboxPusher struct {
 	unkDtypeID     int64
 	unkMfrID       int64
 	unkPlatID      int64
+	unkRirID       int64
 	tagsInit       bool
 	loopBackNet    net.IPNet
 	discoveryTag   []*models.NestedTag
 	placeholderTag []*models.NestedTag
+	endpointTag    []*models.NestedTag
 }
 
 var _ Pusher = (*NetboxPusher)(nil)
@@ -60,14 +69,19 @@ var (
 	discovery_tag_slug     string = slug.Make(discovery_tag_name)
 	placeholder_tag_name   string = "Placeholder"
 	placeholder_tag_slug   string = slug.Make(placeholder_tag_name)
+	endpoint_tag_name      string = "Endpoint"
+	endpoint_tag_slug      string = slug.Make(endpoint_tag_name)
 	unknown_interface_type string = "other"
 )
 
 const (
 	invalid_id            int64  = -1
 	staging_status        string = "staging"
+	connected_status      string = "connected"
 	discovery_tag_color   string = "c0c0c0"
 	placeholder_tag_color string = "ff6600"
+	endpoint_tag_color    string = "2196f3"
+	default_vrf           string = "default"
 )
 
 func New(ctx context.Context, logger *zap.Logger, config *config.Config) Pusher {
@@ -76,7 +90,7 @@ func New(ctx context.Context, logger *zap.Logger, config *config.Config) Pusher
 		Mask: net.CIDRMask(8, 32),
 	}
 	return &NetboxPusher{ctx: ctx, logger: logger, config: config, unkSiteID: invalid_id,
-		unkRoleID: invalid_id, unkDtypeID: invalid_id, unkMfrID: invalid_id, tagsInit: false, loopBackNet: lp}
+		unkRoleID: invalid_id, unkDtypeID: invalid_id, unkMfrID: invalid_id, unkRirID: invalid_id, tagsInit: false, loopBackNet: lp}
 }
 
 func (nb *NetboxPusher) Start() error {
@@ -335,7 +349,7 @@ func (nb *NetboxPusher) CreateInterfaceIpAddress(j []byte, ipChecker NetboxPrima
 	var data models.WritableIPAddress
 
 	//generate ip prefix by our own.
-	nb.createIpPrefix(prefix.String(), nb.discoveryTag)
+	nb.createIpPrefix(prefix.String(), nil, nb.discoveryTag)
 
 	data.Address = &ipData.Address
 	data.AssignedObjectID = &ipData.AsgdObjID
@@ -352,6 +366,72 @@ func (nb *NetboxPusher) CreateInterfaceIpAddress(j []byte, ipChecker NetboxPrima
 	return created.Payload.ID, nil
 }
 
+func (nb *NetboxPusher) CreateEndpointIpAddress(j []byte) (int64, error) {
+	var err error
+	if !nb.tagsInit {
+		if err = nb.initializeDiodeTags(); err != nil {
+			return invalid_id, err
+		}
+	}
+	var ipData NetboxEndpointIpAddress
+	if err = json.Unmarshal(j, &ipData); err != nil {
+		return invalid_id, err
+	}
+
+	ipA, _, err := net.ParseCIDR(ipData.Address)
+	if err != nil {
+		return invalid_id, err
+	}
+	if nb.loopBackNet.Contains(ipA) {
+		nb.logger.Info("ip_address is a loopback address. Therefore, it will not be created", zap.String("ip_address", ipData.Address))
+		return invalid_id, nil
+	}
+
+	ipCheck := ipam.NewIpamIPAddressesListParams()
+	ipCheck.Address = &ipData.Address
+	vrfID, err := nb.getVrfID(ipData.Vrf, true)
+	if err != nil {
+		return invalid_id, err
+	}
+	vrfFilter := "null"
+	if vrfID != nil {
+		vrfFilter = fmt.Sprint(*vrfID)
+	}
+	ipCheck.VrfID = &vrfFilter
+	var list *ipam.IpamIPAddressesListOK
+	list, err = nb.client.Ipam.IpamIPAddressesList(ipCheck, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	if *list.GetPayload().Count != 0 {
+		for _, result := range list.GetPayload().Results {
+			//address already known, either from an interface or other neighbor table
+			return result.ID, nil
+		}
+	}
+
+	ip := ipam.NewIpamIPAddressesCreateParams()
+	ip.Data = &models.WritableIPAddress{
+		Address:     &ipData.Address,
+		Vrf:         vrfID,
+		Description: ipData.Description,
+		Tags:        nb.endpointTag,
+	}
+	// assigned to the interface the endpoint was learned on, the endpoint tag
+	// telling it apart from the addresses of the interface itself
+	if ipData.AsgdObjID > 0 {
+		ip.Data.AssignedObjectType = &ipData.AsgdObjType
+		ip.Data.AssignedObjectID = &ipData.AsgdObjID
+	}
+	var created *ipam.IpamIPAddressesCreateCreated
+	created, err = nb.client.Ipam.IpamIPAddressesCreate(ip, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("endpoint ip address created", zap.String("ip_address", ipData.Address), zap.String("vrf", ipData.Vrf))
+	return created.Payload.ID, nil
+}
+
 func (nb *NetboxPusher) CreateInventory(j []byte) (int64, error) {
 	var err error
 	if !nb.tagsInit {
@@ -404,6 +484,164 @@ func (nb *NetboxPusher) CreateInventory(j []byte) (int64, error) {
 	return created.Payload.ID, nil
 }
 
+func (nb *NetboxPusher) CreateCable(j []byte) (int64, error) {
+	var err error
+	if !nb.tagsInit {
+		if err = nb.initializeDiodeTags(); err != nil {
+			return invalid_id, err
+		}
+	}
+	var cableData NetboxCable
+	if err = json.Unmarshal(j, &cableData); err != nil {
+		return invalid_id, err
+	}
+
+	// an interface terminates a single cable, so the link is already documented
+	// when any of its ends is cabled
+	for _, ifID := range []int64{cableData.AInterfaceID, cableData.BInterfaceID} {
+		ifRead := dcim.NewDcimInterfacesReadParams()
+		ifRead.SetID(ifID)
+		ifc, err := nb.client.Dcim.DcimInterfacesRead(ifRead, nil)
+		if err != nil {
+			return invalid_id, err
+		}
+		if ifc.Payload.Cable != nil {
+			return ifc.Payload.Cable.ID, nil
+		}
+	}
+
+	cable := dcim.NewDcimCablesCreateParams()
+	cable.Data = &models.WritableCable{
+		ATerminations: []*models.GenericObject{{ObjectType: &INTERFACE_OBJ_TYPE, ObjectID: &cableData.AInterfaceID}},
+		BTerminations: []*models.GenericObject{{ObjectType: &INTERFACE_OBJ_TYPE, ObjectID: &cableData.BInterfaceID}},
+		Status:        connected_status,
+		Tags:          nb.discoveryTag,
+	}
+	var created *dcim.DcimCablesCreateCreated
+	created, err = nb.client.Dcim.DcimCablesCreate(cable, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("cable created", zap.Int64("a_interface_id", cableData.AInterfaceID), zap.Int64("b_interface_id", cableData.BInterfaceID))
+	return created.Payload.ID, nil
+}
+
+func (nb *NetboxPusher) CreatePrefix(j []byte) (int64, error) {
+	var err error
+	if !nb.tagsInit {
+		if err = nb.initializeDiodeTags(); err != nil {
+			return invalid_id, err
+		}
+	}
+	var prefixData NetboxPrefix
+	if err = json.Unmarshal(j, &prefixData); err != nil {
+		return invalid_id, err
+	}
+	vrfID, err := nb.getVrfID(prefixData.Vrf, true)
+	if err != nil {
+		return invalid_id, err
+	}
+	return nb.createIpPrefix(prefixData.Prefix, vrfID, nb.discoveryTag)
+}
+
+// GetPrefix returns the id of a prefix already documented in netbox, or
+// invalid_id when neither the prefix nor its vrf are known
+func (nb *NetboxPusher) GetPrefix(j []byte) (int64, error) {
+	var prefixData NetboxPrefix
+	if err := json.Unmarshal(j, &prefixData); err != nil {
+		return invalid_id, err
+	}
+	vrfID, err := nb.getVrfID(prefixData.Vrf, false)
+	if err != nil {
+		return invalid_id, err
+	}
+	if vrfID != nil && *vrfID == invalid_id {
+		return invalid_id, nil
+	}
+	return nb.getIpPrefix(prefixData.Prefix, vrfID)
+}
+
+func (nb *NetboxPusher) GetAsn(asn int64) (int64, error) {
+	asnCheck := ipam.NewIpamAsnsListParams()
+	asnFilter := fmt.Sprint(asn)
+	asnCheck.Asn = &asnFilter
+	var err error
+	var list *ipam.IpamAsnsListOK
+	list, err = nb.client.Ipam.IpamAsnsList(asnCheck, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	if *list.GetPayload().Count != 0 {
+		for _, result := range list.GetPayload().Results {
+			//return first match
+			return result.ID, nil
+		}
+	}
+	return invalid_id, nil
+}
+
+// CreateBgpSession documents the asns of both ends and records the session
+// as a journal entry of the local device, returning the journal entry id
+func (nb *NetboxPusher) CreateBgpSession(j []byte) (int64, error) {
+	var err error
+	if !nb.tagsInit {
+		if err = nb.initializeDiodeTags(); err != nil {
+			return invalid_id, err
+		}
+	}
+	var bgpData NetboxBgpSession
+	if err = json.Unmarshal(j, &bgpData); err != nil {
+		return invalid_id, err
+	}
+	for _, asn := range []int64{bgpData.Asn, bgpData.PeerAsn} {
+		if asn <= 0 {
+			continue
+		}
+		if _, err = nb.createAsn(asn, nb.discoveryTag); err != nil {
+			return invalid_id, err
+		}
+	}
+
+	comments := fmt.Sprintf("BGP session with %s (AS%d) in vrf %s, %s %s: %s", bgpData.Peer, bgpData.PeerAsn,
+		bgpData.Vrf, bgpData.Afi, bgpData.Safi, bgpData.State)
+	if len(bgpData.PeerHostname) > 0 {
+		comments = fmt.Sprintf("BGP session with %s [%s] (AS%d) in vrf %s, %s %s: %s", bgpData.PeerHostname, bgpData.Peer,
+			bgpData.PeerAsn, bgpData.Vrf, bgpData.Afi, bgpData.Safi, bgpData.State)
+	}
+	kind := models.WritableJournalEntryKindSuccess
+	if !bgpData.Established {
+		kind = models.WritableJournalEntryKindWarning
+	}
+	id, err := nb.createJournalEntry(DEVICE_OBJ_TYPE, bgpData.DeviceID, kind, comments)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("bgp session journal entry created", zap.String("peer", bgpData.Peer), zap.Int64("peer_asn", bgpData.PeerAsn))
+	return id, nil
+}
+
+func (nb *NetboxPusher) CreateJournalEntry(j []byte) (int64, error) {
+	var err error
+	if !nb.tagsInit {
+		if err = nb.initializeDiodeTags(); err != nil {
+			return invalid_id, err
+		}
+	}
+	var entryData NetboxJournalEntry
+	if err = json.Unmarshal(j, &entryData); err != nil {
+		return invalid_id, err
+	}
+	if len(entryData.Kind) == 0 {
+		entryData.Kind = models.WritableJournalEntryKindInfo
+	}
+	id, err := nb.createJournalEntry(entryData.ObjectType, entryData.ObjectID, entryData.Kind, entryData.Comments)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("journal entry created", zap.String("object_type", entryData.ObjectType), zap.Int64("object_id", entryData.ObjectID))
+	return id, nil
+}
+
 func (nb *NetboxPusher) initializeDiodeTags() error {
 	var err error
 	if nb.discoveryTag, err = nb.createDiodeTag(&discovery_tag_name, &discovery_tag_slug, discovery_tag_color); err != nil {
@@ -413,6 +651,10 @@ func (nb *NetboxPusher) initializeDiodeTags() error {
 		return err
 	}
 	nb.placeholderTag = append(nb.placeholderTag, nb.discoveryTag...)
+	if nb.endpointTag, err = nb.createDiodeTag(&endpoint_tag_name, &endpoint_tag_slug, endpoint_tag_color); err != nil {
+		return err
+	}
+	nb.endpointTag = append(nb.endpointTag, nb.discoveryTag...)
 	nb.tagsInit = true
 	return nil
 }
@@ -639,9 +881,14 @@ func (nb *NetboxPusher) createPlatform(plat *NetboxPlatform, tag []*models.Neste
 	return created.Payload.ID, nil
 }
 
-func (nb *NetboxPusher) createIpPrefix(prefix string, tag []*models.NestedTag) (int64, error) {
+func (nb *NetboxPusher) getIpPrefix(prefix string, vrfID *int64) (int64, error) {
 	preCheck := ipam.NewIpamPrefixesListParams()
 	preCheck.Prefix = &prefix
+	vrfFilter := "null"
+	if vrfID != nil {
+		vrfFilter = fmt.Sprint(*vrfID)
+	}
+	preCheck.VrfID = &vrfFilter
 	var err error
 	var list *ipam.IpamPrefixesListOK
 	list, err = nb.client.Ipam.IpamPrefixesList(preCheck, nil)
@@ -654,9 +901,19 @@ func (nb *NetboxPusher) createIpPrefix(prefix string, tag []*models.NestedTag) (
 			return result.ID, nil
 		}
 	}
+	return invalid_id, nil
+}
+
+func (nb *NetboxPusher) createIpPrefix(prefix string, vrfID *int64, tag []*models.NestedTag) (int64, error) {
+	id, err := nb.getIpPrefix(prefix, vrfID)
+	if err != nil || id != invalid_id {
+		return id, err
+	}
 	newPrefix := ipam.NewIpamPrefixesCreateParams()
 	newPrefix.Data = &models.WritablePrefix{
 		Prefix: &prefix,
+		Vrf:    vrfID,
+		Tags:   tag,
 	}
 	var created *ipam.IpamPrefixesCreateCreated
 	created, err = nb.client.Ipam.IpamPrefixesCreate(newPrefix, nil)
@@ -667,6 +924,135 @@ func (nb *NetboxPusher) createIpPrefix(prefix string, tag []*models.NestedTag) (
 	return created.Payload.ID, nil
 }
 
+// getVrfID maps a discovered vrf name to its netbox id, nil standing for the
+// global table. Unknown vrfs are created on demand or reported as invalid_id
+func (nb *NetboxPusher) getVrfID(name string, create bool) (*int64, error) {
+	if len(name) == 0 || name == default_vrf {
+		return nil, nil
+	}
+	var id int64
+	var err error
+	if create {
+		id, err = nb.createVrf(name, nb.discoveryTag)
+	} else {
+		id, err = nb.getVrf(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (nb *NetboxPusher) getVrf(name string) (int64, error) {
+	vrfCheck := ipam.NewIpamVrfsListParams()
+	vrfCheck.Name = &name
+	var err error
+	var list *ipam.IpamVrfsListOK
+	list, err = nb.client.Ipam.IpamVrfsList(vrfCheck, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	if *list.GetPayload().Count != 0 {
+		for _, result := range list.GetPayload().Results {
+			//return first match
+			return result.ID, nil
+		}
+	}
+	return invalid_id, nil
+}
+
+func (nb *NetboxPusher) createVrf(name string, tag []*models.NestedTag) (int64, error) {
+	id, err := nb.getVrf(name)
+	if err != nil || id != invalid_id {
+		return id, err
+	}
+	newVrf := ipam.NewIpamVrfsCreateParams()
+	newVrf.Data = &models.WritableVRF{
+		Name: &name,
+		Tags: tag,
+	}
+	var created *ipam.IpamVrfsCreateCreated
+	created, err = nb.client.Ipam.IpamVrfsCreate(newVrf, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("vrf created", zap.String("vrf", name))
+	return created.Payload.ID, nil
+}
+
+func (nb *NetboxPusher) createRir(rir *NetboxObject, tag []*models.NestedTag) (int64, error) {
+	rirCheck := ipam.NewIpamRirsListParams()
+	rirCheck.Slug = &rir.Slug
+	var err error
+	var list *ipam.IpamRirsListOK
+	list, err = nb.client.Ipam.IpamRirsList(rirCheck, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	if *list.GetPayload().Count != 0 {
+		for _, result := range list.GetPayload().Results {
+			//return first match
+			return result.ID, nil
+		}
+	}
+	newRir := ipam.NewIpamRirsCreateParams()
+	newRir.Data = &models.RIR{
+		Name: &rir.Name,
+		Slug: &rir.Slug,
+		Tags: tag,
+	}
+	var created *ipam.IpamRirsCreateCreated
+	created, err = nb.client.Ipam.IpamRirsCreate(newRir, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("rir created", zap.String("rir", rir.Name))
+	return created.Payload.ID, nil
+}
+
+func (nb *NetboxPusher) createAsn(asn int64, tag []*models.NestedTag) (int64, error) {
+	id, err := nb.GetAsn(asn)
+	if err != nil || id != invalid_id {
+		return id, err
+	}
+	// the registry of discovered asns is unknown, so they are assigned to a placeholder rir
+	if nb.unkRirID == invalid_id {
+		unkownObject := &NetboxObject{Name: unknown_name, Slug: unknown_slug}
+		if nb.unkRirID, err = nb.createRir(unkownObject, nb.placeholderTag); err != nil {
+			return invalid_id, err
+		}
+	}
+	newAsn := ipam.NewIpamAsnsCreateParams()
+	newAsn.Data = &models.WritableASN{
+		Asn:  &asn,
+		Rir:  &nb.unkRirID,
+		Tags: tag,
+	}
+	var created *ipam.IpamAsnsCreateCreated
+	created, err = nb.client.Ipam.IpamAsnsCreate(newAsn, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	nb.logger.Info("asn created", zap.Int64("asn", asn))
+	return created.Payload.ID, nil
+}
+
+func (nb *NetboxPusher) createJournalEntry(objType string, objID int64, kind string, comments string) (int64, error) {
+	entry := extras.NewExtrasJournalEntriesCreateParams()
+	entry.Data = &models.WritableJournalEntry{
+		AssignedObjectID:   &objID,
+		AssignedObjectType: &objType,
+		Comments:           &comments,
+		Kind:               kind,
+		Tags:               nb.discoveryTag,
+	}
+	created, err := nb.client.Extras.ExtrasJournalEntriesCreate(entry, nil)
+	if err != nil {
+		return invalid_id, err
+	}
+	return created.Payload.ID, nil
+}
+
 func checkIpVersion(ipAddress string) (string, error) {
 	if ipVers := net.ParseIP(ipAddress); ipVers != nil {
 		if ipVers.To4() != nil {
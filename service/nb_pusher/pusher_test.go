@@ -0,0 +1,146 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package nb_pusher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/orb-community/diode/service/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeNetbox keeps the objects created through the netbox api by path, lists
+// filtering them on the query parameters. Objects are kept as decoded json
+type fakeNetbox struct {
+	mu      sync.Mutex
+	lastID  int64
+	objects map[string][]map[string]interface{}
+}
+
+func (f *fakeNetbox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case http.MethodGet:
+		results := []map[string]interface{}{}
+		for _, obj := range f.objects[r.URL.Path] {
+			match := true
+			for key, values := range r.URL.Query() {
+				if key != "limit" && key != "offset" && !strings.EqualFold(jsonString(obj[key]), values[0]) {
+					match = false
+				}
+			}
+			if match {
+				results = append(results, obj)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(results), "results": results})
+	case http.MethodPost:
+		var obj map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.lastID++
+		obj["id"] = float64(f.lastID)
+		f.objects[r.URL.Path] = append(f.objects[r.URL.Path], obj)
+		// the written fields are returned in their read form, only the id is needed
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": f.lastID})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeNetbox) created(path string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[path]
+}
+
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func newTestPusher(t *testing.T, netbox *fakeNetbox) *NetboxPusher {
+	srv := httptest.NewServer(netbox)
+	t.Cleanup(srv.Close)
+	cfg := &config.Config{NetboxPusher: config.NetboxPusherConfig{
+		Endpoint: strings.TrimPrefix(srv.URL, "http://"),
+		Protocol: "http",
+		Token:    "token",
+	}}
+	nb := New(context.Background(), zap.NewNop(), cfg).(*NetboxPusher)
+	assert.NoError(t, nb.Start())
+	return nb
+}
+
+func TestCreateBgpSession(t *testing.T) {
+	netbox := &fakeNetbox{lastID: 1000, objects: map[string][]map[string]interface{}{
+		"/api/ipam/asns/": {{"id": float64(500), "asn": float64(65002)}},
+	}}
+	nb := newTestPusher(t, netbox)
+
+	session := func(peer string, peerAsn int64, state string) []byte {
+		j, err := json.Marshal(NetboxBgpSession{DeviceID: 5, Vrf: "default", Peer: peer, State: state,
+			Established: state == "Established", Asn: 65001, PeerAsn: peerAsn, Afi: "ipv4", Safi: "unicast"})
+		assert.NoError(t, err)
+		return j
+	}
+	id, err := nb.CreateBgpSession(session("10.0.0.2", 65002, "Established"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, invalid_id, id)
+	_, err = nb.CreateBgpSession(session("10.0.0.3", 65003, "NotEstd"))
+	assert.NoError(t, err)
+
+	// the missing asns are created once, under a single placeholder rir
+	rirs := netbox.created("/api/ipam/rirs/")
+	if assert.Len(t, rirs, 1) {
+		assert.Equal(t, unknown_slug, rirs[0]["slug"])
+	}
+	var asns []float64
+	for _, asn := range netbox.created("/api/ipam/asns/") {
+		asns = append(asns, asn["asn"].(float64))
+		if asn["id"] != float64(500) {
+			assert.Equal(t, rirs[0]["id"], asn["rir"])
+		}
+	}
+	assert.ElementsMatch(t, []float64{65002, 65001, 65003}, asns)
+
+	// each session is journaled on the local device
+	entries := netbox.created("/api/extras/journal-entries/")
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, float64(id), entries[0]["id"])
+		assert.Equal(t, DEVICE_OBJ_TYPE, entries[0]["assigned_object_type"])
+		assert.Equal(t, float64(5), entries[0]["assigned_object_id"])
+		assert.Equal(t, "success", entries[0]["kind"])
+		assert.Equal(t, "warning", entries[1]["kind"])
+		assert.Contains(t, entries[1]["comments"], "AS65003")
+	}
+}
+
+func TestGetAsn(t *testing.T) {
+	nb := newTestPusher(t, &fakeNetbox{objects: map[string][]map[string]interface{}{
+		"/api/ipam/asns/": {{"id": float64(500), "asn": float64(65002)}},
+	}})
+	id, err := nb.GetAsn(65002)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(500), id)
+	id, err = nb.GetAsn(65003)
+	assert.NoError(t, err)
+	assert.Equal(t, invalid_id, id)
+}
@@ -10,6 +10,7 @@ const (
 )
 
 var INTERFACE_OBJ_TYPE string = "dcim.interface"
+var DEVICE_OBJ_TYPE string = "dcim.device"
 
 var DeviceStatusMap = map[string]string{
 	"alive": "active",
@@ -78,6 +79,44 @@ type NetboxIpAddress struct {
 	AsgdObjID   int64  `json:"assigned_object_id"`
 }
 
+type NetboxEndpointIpAddress struct {
+	Address     string `json:"address"`
+	Vrf         string `json:"vrf"`
+	Description string `json:"description"`
+	AsgdObjType string `json:"assigned_object_type"`
+	AsgdObjID   int64  `json:"assigned_object_id"`
+}
+
+type NetboxPrefix struct {
+	Prefix string `json:"prefix"`
+	Vrf    string `json:"vrf"`
+}
+
+type NetboxBgpSession struct {
+	DeviceID     int64  `json:"device_id"`
+	Vrf          string `json:"vrf"`
+	Peer         string `json:"peer"`
+	PeerHostname string `json:"peer_hostname"`
+	State        string `json:"state"`
+	Established  bool   `json:"established"`
+	Asn          int64  `json:"asn"`
+	PeerAsn      int64  `json:"peer_asn"`
+	Afi          string `json:"afi"`
+	Safi         string `json:"safi"`
+}
+
+type NetboxJournalEntry struct {
+	ObjectType string `json:"object_type"`
+	ObjectID   int64  `json:"object_id"`
+	Kind       string `json:"kind"`
+	Comments   string `json:"comments"`
+}
+
+type NetboxCable struct {
+	AInterfaceID int64 `json:"a_interface_id"`
+	BInterfaceID int64 `json:"b_interface_id"`
+}
+
 type NetboxInventory struct {
 	DeviceID int64         `json:"device_id"`
 	Name     string        `json:"name"`
@@ -6,53 +6,222 @@ package otlp
 
 import (
 	"context"
+	"errors"
+	"time"
 
-	"github.com/open-telemetry/opentelemetry-collector-contrib/receiver/kafkareceiver"
+	"github.com/Shopify/sarama"
+	"github.com/orb-community/diode/kafkaauth"
 	"github.com/orb-community/diode/service/config"
-	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/consumer"
-	"go.opentelemetry.io/collector/receiver"
-	"go.opentelemetry.io/otel/metric/global"
-	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.uber.org/zap"
 )
 
+// kafka message encodings
+const (
+	KafkaEncodingProto = "otlp_proto"
+	KafkaEncodingJson  = "otlp_json"
+	// KafkaEncodingRaw messages hold the payload itself
+	KafkaEncodingRaw = "raw"
+)
+
+const kafkaRetryInterval = time.Second
+
+// DiodeKafkaRecv consumes the topic as a member of a consumer group, so
+// replicas sharing the group each get their own partitions. Messages are
+// marked once handed to the service, and the marked offsets are committed
+// when partitions are released and on Stop
 type DiodeKafkaRecv struct {
-	ctx      context.Context
-	logger   *zap.Logger
-	config   *config.Config
-	consumer consumer.Logs
-	receiver receiver.Logs
+	ctx        context.Context
+	logger     *zap.Logger
+	config     *config.Config
+	consumer   consumer.Logs
+	group      sarama.ConsumerGroup
+	cancelFunc context.CancelFunc
+	done       chan struct{}
 }
 
 var _ Otlp = (*DiodeKafkaRecv)(nil)
 
 func (d *DiodeKafkaRecv) Start() error {
-	kFactory := kafkareceiver.NewFactory()
-	cfg := kFactory.CreateDefaultConfig().(*kafkareceiver.Config)
-	cfg.Brokers = d.config.KafkaReceiver.Brokers
-	cfg.Topic = d.config.KafkaReceiver.Topic
-	cfg.ProtocolVersion = d.config.KafkaReceiver.ProtocolVersion
-	set := receiver.CreateSettings{
-		TelemetrySettings: component.TelemetrySettings{
-			Logger:         d.logger,
-			TracerProvider: trace.NewNoopTracerProvider(),
-			MeterProvider:  global.MeterProvider(),
-		},
-		BuildInfo: component.NewDefaultBuildInfo(),
-	}
-	var err error
-	d.receiver, err = kFactory.CreateLogsReceiver(d.ctx, set, cfg, d.consumer)
+	kc := d.config.KafkaReceiver
+	if len(kc.Brokers) == 0 {
+		return errors.New("kafka receiver requires at least one broker")
+	}
+	unmarshal, err := kafkaLogsUnmarshaler(kc.Encoding)
+	if err != nil {
+		return err
+	}
+	cfg, err := kafkaConsumerConfig(kc)
 	if err != nil {
 		return err
 	}
-	err = d.receiver.Start(d.ctx, nil)
+	d.group, err = sarama.NewConsumerGroup(kc.Brokers, kc.GroupID, cfg)
 	if err != nil {
 		return err
 	}
+
+	ctx, cancelFunc := context.WithCancel(d.ctx)
+	d.cancelFunc = cancelFunc
+	d.done = make(chan struct{})
+	handler := &kafkaLogsHandler{logger: d.logger, consumer: d.consumer, unmarshal: unmarshal}
+	go d.consume(ctx, handler)
+	go func() {
+		for err := range d.group.Errors() {
+			d.logger.Error("kafka receiver error", zap.Error(err))
+		}
+	}()
+	d.logger.Info("kafka receiver started", zap.Strings("brokers", kc.Brokers), zap.String("topic", kc.Topic),
+		zap.String("group_id", kc.GroupID), zap.String("encoding", kc.Encoding))
 	return nil
 }
 
+func (d *DiodeKafkaRecv) consume(ctx context.Context, handler sarama.ConsumerGroupHandler) {
+	defer close(d.done)
+	for {
+		// Consume returns on every rebalance, and has to be called again to
+		// get the new partition claims
+		err := d.group.Consume(ctx, []string{d.config.KafkaReceiver.Topic}, handler)
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return
+		}
+		if err != nil {
+			d.logger.Error("kafka receiver consume error", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay(err)):
+		}
+	}
+}
+
+func retryDelay(err error) time.Duration {
+	if err != nil {
+		return kafkaRetryInterval
+	}
+	return 0
+}
+
+// Stop leaves the consumer group, committing the offsets of the messages
+// already handed to the service so no other replica consumes them again
 func (d *DiodeKafkaRecv) Stop() error {
+	if d.group == nil {
+		return nil
+	}
+	d.cancelFunc()
+	<-d.done
+	return d.group.Close()
+}
+
+func kafkaConsumerConfig(kc config.KafkaReceiverConfig) (*sarama.Config, error) {
+	cfg := sarama.NewConfig()
+	if kc.ProtocolVersion != "" {
+		version, err := sarama.ParseKafkaVersion(kc.ProtocolVersion)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Version = version
+	}
+	if kc.ClientID != "" {
+		cfg.ClientID = kc.ClientID
+	}
+	cfg.Consumer.Return.Errors = true
+	switch kc.InitialOffset {
+	case "", "latest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "earliest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		return nil, errors.New("kafka receiver initial offset must be 'latest' or 'earliest'")
+	}
+	if err := kafkaauth.ConfigureSasl(cfg, kc.SaslMechanism, kc.SaslUsername, kc.SaslPassword); err != nil {
+		return nil, err
+	}
+	if kc.TLS {
+		tlsSetting := configtls.TLSClientSetting{
+			TLSSetting: configtls.TLSSetting{
+				CAFile:   kc.TLSCAFile,
+				CertFile: kc.TLSCertFile,
+				KeyFile:  kc.TLSKeyFile,
+			},
+			InsecureSkipVerify: kc.TLSInsecureSkipVerify,
+		}
+		tlsConfig, err := tlsSetting.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = tlsConfig
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func kafkaLogsUnmarshaler(encoding string) (func([]byte) (plog.Logs, error), error) {
+	switch encoding {
+	case "", KafkaEncodingProto:
+		u := &plog.ProtoUnmarshaler{}
+		return u.UnmarshalLogs, nil
+	case KafkaEncodingJson:
+		u := &plog.JSONUnmarshaler{}
+		return u.UnmarshalLogs, nil
+	case KafkaEncodingRaw:
+		return func(data []byte) (plog.Logs, error) {
+			ld := plog.NewLogs()
+			record := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+			record.Body().SetEmptyBytes().FromRaw(data)
+			return ld, nil
+		}, nil
+	default:
+		return nil, errors.New(encoding + " is a invalid kafka receiver encoding")
+	}
+}
+
+type kafkaLogsHandler struct {
+	logger    *zap.Logger
+	consumer  consumer.Logs
+	unmarshal func([]byte) (plog.Logs, error)
+}
+
+var _ sarama.ConsumerGroupHandler = (*kafkaLogsHandler)(nil)
+
+func (h *kafkaLogsHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.logger.Info("kafka receiver partitions assigned", zap.Any("claims", session.Claims()))
 	return nil
 }
+
+// Cleanup commits the marked offsets before the partitions are handed over
+func (h *kafkaLogsHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	return nil
+}
+
+func (h *kafkaLogsHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			logs, err := h.unmarshal(message.Value)
+			if err != nil {
+				// it will fail to decode on every delivery, so it is skipped
+				h.logger.Error("kafka receiver - fail to decode message, skipping it", zap.String("topic", message.Topic),
+					zap.Int32("partition", message.Partition), zap.Int64("offset", message.Offset), zap.Error(err))
+				session.MarkMessage(message, "")
+				continue
+			}
+			// left unmarked when not consumed, so it is delivered again
+			if err = h.consumer.ConsumeLogs(session.Context(), logs); err != nil {
+				return err
+			}
+			session.MarkMessage(message, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,49 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package otlp
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/orb-community/diode/service/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestKafkaConsumerConfig(t *testing.T) {
+	cfg, err := kafkaConsumerConfig(config.KafkaReceiverConfig{ProtocolVersion: "2.0.0", ClientID: "diode-service",
+		InitialOffset: "earliest", SaslMechanism: "SCRAM-SHA-512", SaslUsername: "user", SaslPassword: "pass"})
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.OffsetOldest, cfg.Consumer.Offsets.Initial)
+	assert.Equal(t, "diode-service", cfg.ClientID)
+	assert.True(t, cfg.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), cfg.Net.SASL.Mechanism)
+
+	_, err = kafkaConsumerConfig(config.KafkaReceiverConfig{InitialOffset: "middle"})
+	assert.Error(t, err)
+	_, err = kafkaConsumerConfig(config.KafkaReceiverConfig{SaslMechanism: "GSSAPI"})
+	assert.Error(t, err)
+}
+
+func TestKafkaLogsUnmarshaler(t *testing.T) {
+	_, err := kafkaLogsUnmarshaler("avro")
+	assert.Error(t, err)
+
+	payload := []byte(`{"schema_version":2,"policy":"p","table":"vlan","records":[]}`)
+	unmarshal, err := kafkaLogsUnmarshaler(KafkaEncodingRaw)
+	assert.NoError(t, err)
+	ld, err := unmarshal(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().Bytes().AsRaw())
+
+	body, err := (&plog.ProtoMarshaler{}).MarshalLogs(logsOf(payload))
+	assert.NoError(t, err)
+	unmarshal, err = kafkaLogsUnmarshaler(KafkaEncodingProto)
+	assert.NoError(t, err)
+	ld, err = unmarshal(body)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ld.LogRecordCount())
+}
@@ -6,11 +6,14 @@ package otlp
 
 import (
 	"context"
+	"crypto/x509"
 
 	"github.com/orb-community/diode/service/config"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/plog"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 )
 
 type Otlp interface {
@@ -18,32 +21,41 @@ type Otlp interface {
 	Stop() error
 }
 
+// Payload is an agent payload along with the identity of the client that sent
+// it, taken from its verified certificate when the receiver requires one
+type Payload struct {
+	Data     []byte
+	Identity string
+}
+
 type DiodeLogConsumer struct {
-	channel      chan []byte
+	channel      chan Payload
 	capabilities consumer.Capabilities
+	verifier     *Verifier
 }
 
-func New(ctx context.Context, logger *zap.Logger, config *config.Config, channel chan []byte) Otlp {
+func New(ctx context.Context, logger *zap.Logger, config *config.Config, channel chan Payload, v *Verifier) Otlp {
 	switch tOtlp := config.Base.OtlpReceiverType; tOtlp {
 	case "kafka":
-		return &DiodeKafkaRecv{ctx: ctx, logger: logger, config: config, consumer: newLogConsumer(channel)}
+		return &DiodeKafkaRecv{ctx: ctx, logger: logger, config: config, consumer: newLogConsumer(channel, v)}
 	case "otlp":
-		return &DiodeOtlpRecv{ctx: ctx, logger: logger, config: config, consumer: newLogConsumer(channel)}
+		return &DiodeOtlpRecv{ctx: ctx, logger: logger, config: config, consumer: newLogConsumer(channel, v)}
 	default:
 		break
 	}
 	logger.Warn("Not supported OTLP receiver type. Creating Default OTLP Receiver",
 		zap.String("otlp_receiver_type", config.Base.OtlpReceiverType))
-	return &DiodeOtlpRecv{ctx: ctx, logger: logger, config: config, consumer: newLogConsumer(channel)}
+	return &DiodeOtlpRecv{ctx: ctx, logger: logger, config: config, consumer: newLogConsumer(channel, v)}
 }
 
-func newLogConsumer(channel chan []byte) consumer.Logs {
+func newLogConsumer(channel chan Payload, v *Verifier) consumer.Logs {
 	var cap consumer.Capabilities
 	cap.MutatesData = true
-	return &DiodeLogConsumer{channel: channel, capabilities: cap}
+	return &DiodeLogConsumer{channel: channel, capabilities: cap, verifier: v}
 }
 
 func (dlc *DiodeLogConsumer) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	identity := peerIdentity(ctx)
 	rss := ld.ResourceLogs()
 	for i := 0; i < rss.Len(); i++ {
 		rs := rss.At(i)
@@ -52,14 +64,54 @@ func (dlc *DiodeLogConsumer) ConsumeLogs(ctx context.Context, ld plog.Logs) erro
 			logs := ill.At(i)
 			rec := logs.LogRecords()
 			for i := 0; i < rec.Len(); i++ {
-				val := rec.At(i)
-				dlc.channel <- val.Body().Bytes().AsRaw()
+				data, err := dlc.verifier.Check(rec.At(i).Body().Bytes().AsRaw())
+				if err != nil {
+					continue
+				}
+				select {
+				case dlc.channel <- Payload{Data: data, Identity: identity}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
 		}
 	}
 	return nil
 }
 
+// peerIdentity returns the verified client certificate identity of otlp/http
+// requests, or else of grpc requests
+func peerIdentity(ctx context.Context) string {
+	if identity, ok := ctx.Value(identityKey{}).(string); ok {
+		return identity
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ""
+	}
+	return certIdentity(info.State.VerifiedChains)
+}
+
+// certIdentity returns the common name, or else the first dns name, of the
+// verified client certificate
+func certIdentity(chains [][]*x509.Certificate) string {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	cert := chains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
 func (dlc *DiodeLogConsumer) Capabilities() consumer.Capabilities {
 	return dlc.capabilities
 }
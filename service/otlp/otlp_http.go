@@ -0,0 +1,102 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package otlp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.uber.org/zap"
+)
+
+const (
+	protobufContentType = "application/x-protobuf"
+	jsonContentType     = "application/json"
+)
+
+// identityKey carries the client certificate identity of otlp/http requests
+// to the log consumer
+type identityKey struct{}
+
+// startHttp serves otlp/http logs on /v1/logs. It is served here rather than
+// by the collector receiver, whose handlers do not get the client certificate
+func (d *DiodeOtlpRecv) startHttp(settings confighttp.HTTPServerSettings, telemetry component.TelemetrySettings) error {
+	listener, err := settings.ToListener()
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/logs", d.handleLogs)
+	d.httpServer, err = settings.ToServer(nil, telemetry, mux)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	go func() {
+		if err := d.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			d.logger.Error("otlp http receiver error", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (d *DiodeOtlpRecv) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != protobufContentType && contentType != jsonContentType) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "fail to read request body", http.StatusBadRequest)
+		return
+	}
+	req := plogotlp.NewExportRequest()
+	if contentType == jsonContentType {
+		err = req.UnmarshalJSON(body)
+	} else {
+		err = req.UnmarshalProto(body)
+	}
+	if err != nil {
+		http.Error(w, "fail to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	var identity string
+	if r.TLS != nil {
+		identity = certIdentity(r.TLS.VerifiedChains)
+	}
+	ctx := context.WithValue(r.Context(), identityKey{}, identity)
+	if err = d.consumer.ConsumeLogs(ctx, req.Logs()); err != nil {
+		d.logger.Error("otlp http receiver - fail to consume logs", zap.Error(err))
+		http.Error(w, "fail to consume logs", http.StatusServiceUnavailable)
+		return
+	}
+
+	res := plogotlp.NewExportResponse()
+	var data []byte
+	if contentType == jsonContentType {
+		data, err = res.MarshalJSON()
+	} else {
+		data, err = res.MarshalProto()
+	}
+	if err != nil {
+		http.Error(w, "fail to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -6,9 +6,13 @@ package otlp
 
 import (
 	"context"
+	"errors"
+	"net/http"
 
 	"github.com/orb-community/diode/service/config"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/receiver"
 	"go.opentelemetry.io/collector/receiver/otlpreceiver"
@@ -23,16 +27,21 @@ type DiodeOtlpRecv struct {
 	config   *config.Config
 	consumer consumer.Logs
 	receiver receiver.Logs
+	// otlp/http is served apart from the collector receiver, see startHttp
+	httpServer *http.Server
 }
 
 var _ Otlp = (*DiodeOtlpRecv)(nil)
 
 func (d *DiodeOtlpRecv) Start() error {
-	oFactory := otlpreceiver.NewFactory()
-	cfg := oFactory.CreateDefaultConfig().(*otlpreceiver.Config)
-	cfg.HTTP = nil
-	cfg.GRPC.NetAddr.Endpoint = d.config.OtlpReceiver.Endpoint
-	cfg.GRPC.NetAddr.Transport = d.config.OtlpReceiver.Protocol
+	rc := d.config.OtlpReceiver
+	if rc.Endpoint == "" && rc.HttpEndpoint == "" {
+		return errors.New("otlp receiver requires a grpc or http endpoint")
+	}
+	tlsSetting, err := d.tlsSetting()
+	if err != nil {
+		return err
+	}
 	set := receiver.CreateSettings{
 		TelemetrySettings: component.TelemetrySettings{
 			Logger:         d.logger,
@@ -41,18 +50,68 @@ func (d *DiodeOtlpRecv) Start() error {
 		},
 		BuildInfo: component.NewDefaultBuildInfo(),
 	}
-	var err error
-	d.receiver, err = oFactory.CreateLogsReceiver(d.ctx, set, cfg, d.consumer)
-	if err != nil {
-		return err
+	// an empty endpoint disables its protocol, so the receiver can run over
+	// grpc, http or both
+	if rc.Endpoint != "" {
+		oFactory := otlpreceiver.NewFactory()
+		cfg := oFactory.CreateDefaultConfig().(*otlpreceiver.Config)
+		cfg.GRPC.NetAddr.Endpoint = rc.Endpoint
+		cfg.GRPC.NetAddr.Transport = rc.Protocol
+		cfg.GRPC.TLSSetting = tlsSetting
+		cfg.HTTP = nil
+		d.receiver, err = oFactory.CreateLogsReceiver(d.ctx, set, cfg, d.consumer)
+		if err != nil {
+			return err
+		}
+		if err = d.receiver.Start(d.ctx, nil); err != nil {
+			return err
+		}
 	}
-	err = d.receiver.Start(d.ctx, nil)
-	if err != nil {
-		return err
+	if rc.HttpEndpoint != "" {
+		settings := confighttp.HTTPServerSettings{Endpoint: rc.HttpEndpoint, TLSSetting: tlsSetting}
+		if err = d.startHttp(settings, set.TelemetrySettings); err != nil {
+			return errors.Join(err, d.Stop())
+		}
 	}
+	d.logger.Info("otlp receiver started", zap.String("grpc_endpoint", rc.Endpoint),
+		zap.String("http_endpoint", rc.HttpEndpoint), zap.Bool("tls", tlsSetting != nil),
+		zap.Bool("client_auth", rc.ClientCAFile != ""))
 	return nil
 }
 
+// tlsSetting returns the receiver tls settings, falling back to the service
+// server_cert and server_key, or nil when no certificate is set
+func (d *DiodeOtlpRecv) tlsSetting() (*configtls.TLSServerSetting, error) {
+	rc := d.config.OtlpReceiver
+	certFile, keyFile := rc.TLSCertFile, rc.TLSKeyFile
+	if certFile == "" && keyFile == "" {
+		certFile, keyFile = d.config.Base.HttpServerCert, d.config.Base.HttpServerKey
+	}
+	if certFile == "" && keyFile == "" {
+		if rc.ClientCAFile != "" {
+			return nil, errors.New("otlp receiver client ca requires a tls certificate")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("otlp receiver tls certificate and key must be set together")
+	}
+	return &configtls.TLSServerSetting{
+		TLSSetting:   configtls.TLSSetting{CertFile: certFile, KeyFile: keyFile},
+		ClientCAFile: rc.ClientCAFile,
+	}, nil
+}
+
+// Stop shuts the receiver down, releasing its grpc and http ports
 func (d *DiodeOtlpRecv) Stop() error {
-	return nil
+	// the service context may already be cancelled when stopping
+	ctx := context.Background()
+	var errs error
+	if d.receiver != nil {
+		errs = d.receiver.Shutdown(ctx)
+	}
+	if d.httpServer != nil {
+		errs = errors.Join(errs, d.httpServer.Shutdown(ctx))
+	}
+	return errs
 }
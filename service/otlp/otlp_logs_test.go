@@ -0,0 +1,215 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/orb-community/diode/service/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+func freeEndpoint(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// testPKI writes a ca, a server certificate for 127.0.0.1 and returns the
+// receiver config using them, along with the client tls config of agent-1
+func testPKI(t *testing.T) (config.OtlpReceiverConfig, *tls.Config) {
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "diode-ca"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDer)
+	assert.NoError(t, err)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (string, string, tls.Certificate) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		template := &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: name},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+			KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{usage},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		assert.NoError(t, err)
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		assert.NoError(t, err)
+		certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		assert.NoError(t, os.WriteFile(certFile, certPem, 0600))
+		assert.NoError(t, os.WriteFile(keyFile, keyPem, 0600))
+		pair, err := tls.X509KeyPair(certPem, keyPem)
+		assert.NoError(t, err)
+		return certFile, keyFile, pair
+	}
+	serverCert, serverKey, _ := issue(2, "diode-service", x509.ExtKeyUsageServerAuth)
+	_, _, clientPair := issue(3, "agent-1", x509.ExtKeyUsageClientAuth)
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0600))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return config.OtlpReceiverConfig{TLSCertFile: serverCert, TLSKeyFile: serverKey, ClientCAFile: caFile},
+		&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientPair}}
+}
+
+func receive(t *testing.T, channel chan Payload) Payload {
+	select {
+	case data := <-channel:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("payload not received")
+	}
+	return Payload{}
+}
+
+func TestOtlpHttpReceiver(t *testing.T) {
+	endpoint := freeEndpoint(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	channel := make(chan Payload, 1)
+	cfg := &config.Config{OtlpReceiver: config.OtlpReceiverConfig{HttpEndpoint: endpoint}}
+	recv := &DiodeOtlpRecv{ctx: ctx, logger: zap.NewNop(), config: cfg, consumer: newLogConsumer(channel, nil)}
+	assert.NoError(t, recv.Start())
+
+	payload := []byte(`{"schema_version":2,"policy":"p","table":"vlan","records":[]}`)
+	body, err := plogotlp.NewExportRequestFromLogs(logsOf(payload)).MarshalProto()
+	assert.NoError(t, err)
+	res, err := http.Post("http://"+endpoint+"/v1/logs", "application/x-protobuf", bytes.NewReader(body))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	select {
+	case data := <-channel:
+		assert.Equal(t, payload, data.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("payload not received")
+	}
+
+	assert.NoError(t, recv.Stop())
+	l, err := net.Listen("tcp", endpoint)
+	assert.NoError(t, err, "receiver port not released")
+	l.Close()
+
+	recv = &DiodeOtlpRecv{ctx: ctx, logger: zap.NewNop(), config: &config.Config{}, consumer: newLogConsumer(channel, nil)}
+	assert.Error(t, recv.Start())
+}
+
+func TestOtlpHttpReceiverIdentity(t *testing.T) {
+	rc, clientTLS := testPKI(t)
+	rc.HttpEndpoint = freeEndpoint(t)
+	channel := make(chan Payload, 1)
+	recv := &DiodeOtlpRecv{ctx: context.Background(), logger: zap.NewNop(), config: &config.Config{OtlpReceiver: rc},
+		consumer: newLogConsumer(channel, nil)}
+	assert.NoError(t, recv.Start())
+	defer recv.Stop()
+
+	payload := []byte(`{"schema_version":2,"policy":"p","table":"vlan","records":[]}`)
+	body, err := plogotlp.NewExportRequestFromLogs(logsOf(payload)).MarshalJSON()
+	assert.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	res, err := client.Post("https://"+rc.HttpEndpoint+"/v1/logs", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	data := receive(t, channel)
+	assert.Equal(t, payload, data.Data)
+	assert.Equal(t, "agent-1", data.Identity)
+
+	// agents without a client certificate are rejected
+	anonymous := clientTLS.Clone()
+	anonymous.Certificates = nil
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: anonymous}}
+	_, err = client.Post("https://"+rc.HttpEndpoint+"/v1/logs", "application/json", bytes.NewReader(body))
+	assert.Error(t, err)
+}
+
+func TestOtlpGrpcReceiverIdentity(t *testing.T) {
+	rc, clientTLS := testPKI(t)
+	rc.Endpoint = freeEndpoint(t)
+	rc.Protocol = "tcp"
+	channel := make(chan Payload, 1)
+	recv := &DiodeOtlpRecv{ctx: context.Background(), logger: zap.NewNop(), config: &config.Config{OtlpReceiver: rc},
+		consumer: newLogConsumer(channel, nil)}
+	assert.NoError(t, recv.Start())
+	defer recv.Stop()
+
+	conn, err := grpc.Dial(rc.Endpoint, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	assert.NoError(t, err)
+	defer conn.Close()
+	payload := []byte(`{"schema_version":2,"policy":"p","table":"vlan","records":[]}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = plogotlp.NewGRPCClient(conn).Export(ctx, plogotlp.NewExportRequestFromLogs(logsOf(payload)))
+	assert.NoError(t, err)
+	data := receive(t, channel)
+	assert.Equal(t, payload, data.Data)
+	assert.Equal(t, "agent-1", data.Identity)
+}
+
+func TestPeerIdentity(t *testing.T) {
+	assert.Empty(t, peerIdentity(context.Background()))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}}
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+	assert.Equal(t, "agent-1", peerIdentity(ctx))
+
+	cert.Subject.CommonName = ""
+	cert.DNSNames = []string{"agent-1.example.com"}
+	assert.Equal(t, "agent-1.example.com", peerIdentity(ctx))
+
+	ctx = context.WithValue(context.Background(), identityKey{}, "agent-2")
+	assert.Equal(t, "agent-2", peerIdentity(ctx))
+}
+
+func TestOtlpReceiverTLSSetting(t *testing.T) {
+	recv := &DiodeOtlpRecv{config: &config.Config{
+		Base:         config.BaseSvcConfig{HttpServerCert: "server.pem", HttpServerKey: "server-key.pem"},
+		OtlpReceiver: config.OtlpReceiverConfig{ClientCAFile: "ca.pem"},
+	}}
+	setting, err := recv.tlsSetting()
+	assert.NoError(t, err)
+	assert.Equal(t, "server.pem", setting.CertFile)
+	assert.Equal(t, "ca.pem", setting.ClientCAFile)
+
+	recv.config = &config.Config{OtlpReceiver: config.OtlpReceiverConfig{ClientCAFile: "ca.pem"}}
+	_, err = recv.tlsSetting()
+	assert.Error(t, err)
+
+	recv.config = &config.Config{OtlpReceiver: config.OtlpReceiverConfig{TLSCertFile: "server.pem"}}
+	_, err = recv.tlsSetting()
+	assert.Error(t, err)
+}
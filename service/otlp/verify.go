@@ -0,0 +1,168 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package otlp
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/orb-community/diode/envelope"
+	"github.com/orb-community/diode/service/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// signing modes
+const (
+	// SigningOff accepts every payload without checking signatures
+	SigningOff = "off"
+	// SigningReject drops unsigned or invalid payloads
+	SigningReject = "reject"
+	// SigningQuarantine keeps unsigned or invalid payloads aside in the quarantine dir
+	SigningQuarantine = "quarantine"
+)
+
+var (
+	errUnsigned       = errors.New("payload is not signed")
+	errUntrustedKey   = errors.New("payload signed with an untrusted key")
+	errNoAgentPayload = errors.New("signed payload does not belong to a single agent")
+)
+
+// TrustedKey is a key an agent is allowed to sign its payloads with
+type TrustedKey struct {
+	KeyID     string `yaml:"key_id"`
+	Algorithm string `yaml:"algorithm"`
+	// base64 encoded shared secret for hmac-sha256, or public key for ed25519
+	Key string `yaml:"key"`
+}
+
+type trustedKeys struct {
+	Agents map[string][]TrustedKey `yaml:"agents"`
+}
+
+// Verifier checks the payloads are signed by a key trusted for the agent
+// they claim to come from
+type Verifier struct {
+	logger        *zap.Logger
+	mode          string
+	quarantineDir string
+	keys          map[string]map[string]trustedKey
+}
+
+type trustedKey struct {
+	algorithm string
+	key       []byte
+}
+
+// NewVerifier returns the payload verifier of the signing mode, nil when
+// signatures are not checked
+func NewVerifier(logger *zap.Logger, sc config.SigningConfig) (*Verifier, error) {
+	switch sc.Mode {
+	case "", SigningOff:
+		return nil, nil
+	case SigningReject:
+	case SigningQuarantine:
+		if sc.QuarantineDir == "" {
+			return nil, errors.New("signing quarantine mode requires a quarantine dir")
+		}
+		if err := os.MkdirAll(sc.QuarantineDir, 0755); err != nil {
+			return nil, errors.Join(errors.New("fail to create quarantine dir"), err)
+		}
+	default:
+		return nil, errors.New(sc.Mode + " is a invalid signing mode")
+	}
+	if sc.TrustedKeys == "" {
+		return nil, errors.New("signing requires a trusted keys file")
+	}
+	data, err := os.ReadFile(sc.TrustedKeys)
+	if err != nil {
+		return nil, errors.Join(errors.New("fail to read trusted keys"), err)
+	}
+	var tk trustedKeys
+	if err = yaml.Unmarshal(data, &tk); err != nil {
+		return nil, errors.Join(errors.New("fail to parse trusted keys"), err)
+	}
+	v := &Verifier{logger: logger, mode: sc.Mode, quarantineDir: sc.QuarantineDir,
+		keys: make(map[string]map[string]trustedKey, len(tk.Agents))}
+	for agentID, keys := range tk.Agents {
+		v.keys[agentID] = make(map[string]trustedKey, len(keys))
+		for _, k := range keys {
+			key, err := base64.StdEncoding.DecodeString(k.Key)
+			if err != nil {
+				return nil, errors.Join(errors.New("invalid key '"+k.KeyID+"' of agent '"+agentID+"'"), err)
+			}
+			v.keys[agentID][k.KeyID] = trustedKey{algorithm: k.Algorithm, key: key}
+		}
+	}
+	logger.Info("payload signature verification enabled", zap.String("mode", sc.Mode), zap.Int("agents", len(v.keys)))
+	return v, nil
+}
+
+// Check returns the payload to ingest, once its signature is verified when
+// signing is enabled. Rejected payloads are dropped or quarantined
+func (v *Verifier) Check(data []byte) ([]byte, error) {
+	if v == nil {
+		return data, nil
+	}
+	payload, err := v.verify(data)
+	if err != nil {
+		v.reject(data, err)
+		return nil, err
+	}
+	return payload, nil
+}
+
+// verify returns the signed payload once its signature is checked against
+// the keys trusted for its agent
+func (v *Verifier) verify(data []byte) ([]byte, error) {
+	s, signed, err := envelope.Unwrap(data)
+	if err != nil {
+		return nil, err
+	}
+	if !signed {
+		return nil, errUnsigned
+	}
+	envelopes, err := envelope.Decode(s.Payload)
+	if err != nil {
+		return nil, err
+	}
+	agentID := envelopes[0].AgentID
+	for _, e := range envelopes {
+		if e.AgentID == "" || e.AgentID != agentID {
+			return nil, errNoAgentPayload
+		}
+	}
+	k, ok := v.keys[agentID][s.KeyID]
+	if !ok || k.algorithm != s.Algorithm {
+		return nil, errUntrustedKey
+	}
+	if err = envelope.Verify(s, k.key); err != nil {
+		return nil, err
+	}
+	return s.Payload, nil
+}
+
+// reject drops the payload, keeping it in the quarantine dir when enabled
+func (v *Verifier) reject(data []byte, reason error) {
+	if v.mode != SigningQuarantine {
+		v.logger.Warn("rejecting payload", zap.Error(reason))
+		return
+	}
+	f, err := os.CreateTemp(v.quarantineDir, strconv.FormatInt(time.Now().UnixNano(), 10)+"_*.payload")
+	if err == nil {
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		v.logger.Error("fail to quarantine payload, dropping it", zap.NamedError("reason", reason), zap.Error(err))
+		return
+	}
+	v.logger.Warn("quarantined payload", zap.String("path", f.Name()), zap.Error(reason))
+}
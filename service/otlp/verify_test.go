@@ -0,0 +1,70 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package otlp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orb-community/diode/envelope"
+	"github.com/orb-community/diode/service/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+)
+
+func logsOf(payloads ...[]byte) plog.Logs {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, p := range payloads {
+		records.AppendEmpty().Body().SetEmptyBytes().FromRaw(p)
+	}
+	return ld
+}
+
+func TestLogConsumerVerifiesSignatures(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	keys := "agents:\n  agent_1:\n    - key_id: k1\n      algorithm: ed25519\n      key: " +
+		base64.StdEncoding.EncodeToString(pub) + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "keys.yaml"), []byte(keys), 0644))
+	quarantine := filepath.Join(dir, "quarantine")
+
+	v, err := NewVerifier(zap.NewNop(), config.SigningConfig{Mode: SigningQuarantine,
+		TrustedKeys: filepath.Join(dir, "keys.yaml"), QuarantineDir: quarantine})
+	assert.NoError(t, err)
+	channel := make(chan Payload, 8)
+	c := newLogConsumer(channel, v)
+
+	payload := []byte(`{"schema_version":2,"agent_id":"agent_1","policy":"p","table":"vlan","records":[]}`)
+	valid, err := envelope.Sign(payload, envelope.AlgEd25519, "k1", priv.Seed())
+	assert.NoError(t, err)
+	spoofed, err := envelope.Sign([]byte(`{"schema_version":2,"agent_id":"agent_2","policy":"p","table":"vlan","records":[]}`),
+		envelope.AlgEd25519, "k1", priv.Seed())
+	assert.NoError(t, err)
+	_, other, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	forged, err := envelope.Sign(payload, envelope.AlgEd25519, "k1", other.Seed())
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.ConsumeLogs(context.Background(), logsOf(valid, payload, spoofed, forged)))
+	assert.Len(t, channel, 1)
+	assert.Equal(t, payload, (<-channel).Data)
+
+	quarantined, err := os.ReadDir(quarantine)
+	assert.NoError(t, err)
+	assert.Len(t, quarantined, 3)
+
+	_, err = NewVerifier(zap.NewNop(), config.SigningConfig{Mode: SigningReject})
+	assert.Error(t, err)
+	v, err = NewVerifier(zap.NewNop(), config.SigningConfig{Mode: SigningOff})
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+}
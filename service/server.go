@@ -0,0 +1,177 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ginzap "github.com/gin-contrib/zap"
+	"github.com/gin-gonic/gin"
+	"github.com/orb-community/diode/envelope"
+	"github.com/orb-community/diode/service/otlp"
+	"go.uber.org/zap"
+)
+
+const (
+	maxIngestBodySize = 16 * 1024 * 1024
+	shutdownTimeout   = 5 * time.Second
+	identityKey       = "identity"
+)
+
+type ReturnValue struct {
+	Message string `json:"message"`
+}
+
+// apiToken is a bearer token along with the name identifying its holder
+type apiToken struct {
+	name  string
+	token []byte
+}
+
+// startServer starts the http ingest and query api when an http port is set
+func (ds *DiodeService) startServer() error {
+	port := ds.config.Base.HttpPort
+	if port == "" {
+		return nil
+	}
+	ingestTokens, err := parseApiTokens("ingest token", ds.config.Base.IngestTokens)
+	if err != nil {
+		return err
+	}
+	readTokens, err := parseApiTokens("read token", ds.config.Base.ReadTokens)
+	if err != nil {
+		return err
+	}
+	if len(ingestTokens) == 0 && len(readTokens) == 0 {
+		return errors.New("http server requires at least one ingest or read token")
+	}
+	certFile, keyFile := ds.config.Base.HttpServerCert, ds.config.Base.HttpServerKey
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("http server certificate and key must be set together")
+	}
+	addr := port
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	ds.server = &http.Server{Addr: addr, Handler: ds.newRouter(ingestTokens, readTokens), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		ds.logger.Info("starting diode service http server at: "+addr, zap.Bool("tls", certFile != ""))
+		var err error
+		if certFile != "" {
+			err = ds.server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = ds.server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			ds.logger.Error("diode service http server error", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (ds *DiodeService) stopServer() error {
+	if ds.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return ds.server.Shutdown(ctx)
+}
+
+// newRouter serves the ingest route to the ingest tokens and the query routes
+// to the read tokens, so a token able to look records up cannot submit any
+func (ds *DiodeService) newRouter(ingestTokens, readTokens []apiToken) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+
+	router.Use(ginzap.Ginzap(ds.logger, time.RFC3339, true))
+	router.Use(ginzap.RecoveryWithZap(ds.logger, true))
+
+	ingest := router.Group("/api/v1", authenticate(ingestTokens))
+	ingest.POST("/ingest", ds.ingest)
+
+	query := router.Group("/api/v1", authenticate(readTokens))
+	query.GET("/devices", ds.getDevices)
+	query.GET("/endpoints/:mac", ds.locateEndpoint)
+	query.GET("/validations/:policy", ds.getValidationResults)
+	query.GET("/device-configs/:policy/:namespace/:hostname", ds.getDeviceConfigs)
+	query.GET("/device-configs/:policy/:namespace/:hostname/diff", ds.getDeviceConfigDiff)
+	return router
+}
+
+// parseApiTokens reads the "<name>:<token>" entries, the name being the
+// identity the ingested records are stored with
+func parseApiTokens(setting string, entries []string) ([]apiToken, error) {
+	tokens := make([]apiToken, 0, len(entries))
+	for i, entry := range entries {
+		name, token, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" || token == "" {
+			// the entry itself is left out, not to log the token
+			return nil, errors.New(setting + " entry " + strconv.Itoa(i+1) + " must be set as <name>:<token>")
+		}
+		tokens = append(tokens, apiToken{name: name, token: []byte(token)})
+	}
+	return tokens, nil
+}
+
+func authenticate(tokens []apiToken) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			for _, t := range tokens {
+				if subtle.ConstantTimeCompare([]byte(bearer), t.token) == 1 {
+					c.Set(identityKey, t.name)
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ReturnValue{"invalid or missing token"})
+	}
+}
+
+// ingest accepts the payloads sent by the agent http output, feeding them to
+// the same channel as the otlp receiver
+func (ds *DiodeService) ingest(c *gin.Context) {
+	if t := c.ContentType(); t != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, ReturnValue{"invalid Content-Type. Only 'application/json' is supported"})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIngestBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, ReturnValue{"payload too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+	data, err := ds.verifier.Check(body)
+	if err != nil {
+		c.JSON(http.StatusForbidden, ReturnValue{err.Error()})
+		return
+	}
+	envelopes, err := envelope.Decode(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+
+	select {
+	case ds.channel <- otlp.Payload{Data: data, Identity: c.GetString(identityKey)}:
+		c.JSON(http.StatusAccepted, ReturnValue{strconv.Itoa(len(envelopes)) + " envelopes accepted"})
+	case <-c.Request.Context().Done():
+		c.JSON(http.StatusServiceUnavailable, ReturnValue{"request cancelled before the payload was queued"})
+	}
+}
@@ -0,0 +1,108 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/orb-community/diode/service/config"
+	"github.com/orb-community/diode/service/otlp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIngest(t *testing.T) {
+	ds := &DiodeService{logger: zap.NewNop(), config: &config.Config{}, channel: make(chan otlp.Payload, 1)}
+	tokens, err := parseApiTokens("ingest token", []string{"lab-agents:secret", " other-agents:other"})
+	assert.NoError(t, err)
+	router := ds.newRouter(tokens, nil)
+
+	post := func(token string, contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	payload := `{"schema_version":2,"agent_id":"agent_1","policy":"p","table":"vlan","records":[]}`
+	assert.Equal(t, http.StatusUnauthorized, post("", "application/json", payload).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", "application/json", payload).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, post("secret", "text/plain", payload).Code)
+	assert.Equal(t, http.StatusBadRequest, post("secret", "application/json", `{"schema_version":99}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("secret", "application/json", "not json").Code)
+
+	assert.Equal(t, http.StatusAccepted, post("secret", "application/json", payload).Code)
+	received := <-ds.channel
+	assert.Equal(t, payload, string(received.Data))
+	assert.Equal(t, "lab-agents", received.Identity)
+
+	assert.Equal(t, http.StatusAccepted, post("other", "application/json; charset=utf-8", payload).Code)
+	assert.Equal(t, "other-agents", (<-ds.channel).Identity)
+}
+
+func TestParseApiTokens(t *testing.T) {
+	tokens, err := parseApiTokens("ingest token", []string{"lab-agents:secret", "dc-agents:s3:cr3t"})
+	assert.NoError(t, err)
+	assert.Equal(t, []apiToken{{name: "lab-agents", token: []byte("secret")}, {name: "dc-agents", token: []byte("s3:cr3t")}}, tokens)
+
+	for _, entry := range []string{"secret", "", ":secret", "lab-agents:"} {
+		_, err = parseApiTokens("ingest token", []string{"lab-agents:secret", entry})
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestApiRequiresToken(t *testing.T) {
+	_, router := newTestService(t)
+	for authorization, code := range map[string]int{
+		"":                          http.StatusUnauthorized,
+		"Bearer wrong":              http.StatusUnauthorized,
+		testToken:                   http.StatusUnauthorized,
+		"Bearer " + testToken:       http.StatusOK,
+		"Bearer " + testToken + "x": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/validations/policy", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, authorization)
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	ds := &DiodeService{logger: zap.NewNop(), config: &config.Config{}, channel: make(chan otlp.Payload, 1)}
+	ingestTokens, err := parseApiTokens("ingest token", []string{"agents:ingest-secret"})
+	assert.NoError(t, err)
+	readTokens, err := parseApiTokens("read token", []string{"dashboards:read-secret"})
+	assert.NoError(t, err)
+	router := ds.newRouter(ingestTokens, readTokens)
+
+	send := func(method, path, token string) int {
+		body := `{"schema_version":2,"agent_id":"agent_1","policy":"p","table":"vlan","records":[]}`
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	// a read token cannot submit data, nor an ingest token look records up
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/api/v1/ingest", "read-secret"))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/endpoints/00:11:22:33:44:55", "ingest-secret"))
+	assert.Equal(t, http.StatusUnauthorized, send(http.MethodGet, "/api/v1/devices", "ingest-secret"))
+	assert.Empty(t, ds.channel)
+
+	assert.Equal(t, http.StatusAccepted, send(http.MethodPost, "/api/v1/ingest", "ingest-secret"))
+	assert.Equal(t, "agents", (<-ds.channel).Identity)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/api/v1/endpoints/not-a-mac", "read-secret"))
+}
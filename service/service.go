@@ -7,7 +7,10 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
 
+	"github.com/orb-community/diode/envelope"
 	"github.com/orb-community/diode/service/config"
 	"github.com/orb-community/diode/service/nb_pusher"
 	"github.com/orb-community/diode/service/otlp"
@@ -19,13 +22,20 @@ import (
 type Service interface {
 	Start() error
 	Stop() error
+	LocateEndpoint(macAddress string) ([]storage.DbEndpointLocation, error)
+	GetValidationResults(policy string) ([]storage.DbValidation, error)
+	GetDevicesByAgent(filter storage.AgentFilter) ([]storage.DbDevice, error)
+	GetDeviceConfigs(policy, namespace, hostname, agentId string) ([]storage.DbDeviceConfig, error)
+	GetDeviceConfigDiff(policy, namespace, hostname, agentId string, version int64) (string, error)
 }
 
 type DiodeService struct {
 	logger             *zap.Logger
 	config             *config.Config
-	channel            chan []byte
+	channel            chan otlp.Payload
 	otlpRecv           otlp.Otlp
+	verifier           *otlp.Verifier
+	server             *http.Server
 	pusher             nb_pusher.Pusher
 	cancelAsyncContext context.CancelFunc
 	asyncContext       context.Context
@@ -42,8 +52,13 @@ func New(ctx context.Context, cancelFunc context.CancelFunc, logger *zap.Logger,
 		cancelFunc()
 		return nil, err
 	}
-	channel := make(chan []byte, 16)
-	otlpRecv := otlp.New(ctx, logger, config, channel)
+	channel := make(chan otlp.Payload, 16)
+	verifier, err := otlp.NewVerifier(logger, config.Signing)
+	if err != nil {
+		cancelFunc()
+		return nil, err
+	}
+	otlpRecv := otlp.New(ctx, logger, config, channel, verifier)
 	err = otlpRecv.Start()
 	if err != nil {
 		cancelFunc()
@@ -60,6 +75,7 @@ func New(ctx context.Context, cancelFunc context.CancelFunc, logger *zap.Logger,
 		config:             config,
 		channel:            channel,
 		otlpRecv:           otlpRecv,
+		verifier:           verifier,
 		pusher:             pusher,
 		cancelAsyncContext: cancelFunc,
 		asyncContext:       ctx,
@@ -73,23 +89,19 @@ func (ds *DiodeService) Start() error {
 	go func() {
 		for {
 			select {
-			case data := <-ds.channel:
-				var jsonData map[string]interface{}
-				var err error
-				if err = json.Unmarshal(data, &jsonData); err != nil {
-					ds.logger.Error("fail to unmarshal json", zap.Error(err))
+			case payload := <-ds.channel:
+				envelopes, err := envelope.Decode(payload.Data)
+				if errors.Is(err, envelope.ErrUnsupportedVersion) {
+					ds.logger.Error("rejecting payload with unsupported schema version", zap.Error(err))
 					break
 				}
-				for policy, logEntryData := range jsonData {
-					ret, err := ds.storageService.Save(policy, logEntryData.(map[string]interface{}))
-					if err != nil {
-						ds.logger.Error("error during storing", zap.String("policy", policy), zap.Error(err))
-					}
-					if err = ds.translate.Translate(ret); err != nil {
-						ds.logger.Error("error during traslating data", zap.String("policy", policy), zap.Error(err))
-					}
+				if err != nil {
+					ds.logger.Error("fail to decode payload", zap.Error(err))
+					break
+				}
+				for _, env := range envelopes {
+					ds.handle(env, payload.Identity)
 				}
-
 
 			case <-ds.asyncContext.Done():
 				ds.logger.Info("service context cancelled")
@@ -98,14 +110,117 @@ func (ds *DiodeService) Start() error {
 		}
 	}()
 
+	if err := ds.startServer(); err != nil {
+		return err
+	}
+
 	ds.logger.Info("diode service started")
 	return nil
 }
 
+func (ds *DiodeService) handle(env envelope.Envelope, identity string) {
+	var records interface{}
+	if err := json.Unmarshal(env.Records, &records); err != nil {
+		ds.logger.Error("invalid envelope records", zap.String("policy", env.Policy), zap.String("table", env.Table), zap.Error(err))
+		return
+	}
+	if env.Run != nil {
+		run := storage.RunInfo{Id: env.Run.ID, Sequence: env.Run.Sequence, Timestamp: env.Run.Timestamp}
+		if env.Table == envelope.RunCompleteTable {
+			ds.completeRun(env.Policy, run, env.Records)
+			return
+		}
+		ds.trackRun(env.Policy, run, env.Table, records)
+	}
+	var cfg interface{}
+	if len(env.Config) > 0 {
+		if err := json.Unmarshal(env.Config, &cfg); err != nil {
+			ds.logger.Error("invalid envelope config", zap.String("policy", env.Policy), zap.Error(err))
+			return
+		}
+	}
+	agent := storage.AgentInfo{Id: env.AgentID, Tags: env.Tags, Identity: identity}
+	if len(env.Removed) > 0 {
+		removed, err := ds.storageService.RemoveRecords(env.Policy, agent, env.Table, env.Removed)
+		if err != nil {
+			ds.logger.Error("error during removing", zap.String("policy", env.Policy), zap.String("table", env.Table), zap.Error(err))
+		}
+		ds.logger.Debug("removed records", zap.String("policy", env.Policy), zap.String("table", env.Table), zap.Int64("count", removed))
+	}
+	if list, ok := records.([]interface{}); ok && len(list) == 0 && env.Mode == envelope.ModeDelta {
+		return
+	}
+	entry := map[string]interface{}{"config": cfg, env.Table: records}
+	ret, err := ds.storageService.Save(env.Policy, agent, entry)
+	if err != nil {
+		ds.logger.Error("error during storing", zap.String("policy", env.Policy), zap.Error(err))
+	}
+	if err = ds.translate.Translate(ret); err != nil {
+		ds.logger.Error("error during traslating data", zap.String("policy", env.Policy), zap.Error(err))
+	}
+}
+
+func (ds *DiodeService) trackRun(policy string, run storage.RunInfo, table string, data interface{}) {
+	records, ok := data.([]interface{})
+	if !ok {
+		return
+	}
+	if _, err := ds.storageService.UpdateRun(policy, run, table, int64(len(records))); err != nil {
+		ds.logger.Error("error during run tracking", zap.String("policy", policy), zap.String("run", run.Id), zap.Error(err))
+	}
+}
+
+func (ds *DiodeService) completeRun(policy string, run storage.RunInfo, data json.RawMessage) {
+	var complete struct {
+		Tables map[string]int64 `json:"tables"`
+	}
+	if err := json.Unmarshal(data, &complete); err != nil {
+		ds.logger.Error("invalid run completion", zap.String("policy", policy), zap.String("run", run.Id), zap.Error(err))
+		return
+	}
+	dbRun, err := ds.storageService.CompleteRun(policy, run, complete.Tables)
+	if err != nil {
+		ds.logger.Error("error during run completion", zap.String("policy", policy), zap.String("run", run.Id), zap.Error(err))
+		return
+	}
+	if !dbRun.Complete {
+		ds.logger.Warn("run finished with missing discovery data", zap.String("policy", policy), zap.String("run", run.Id),
+			zap.Any("expected", dbRun.Expected), zap.Any("received", dbRun.Received))
+		return
+	}
+	ds.logger.Info("run completed with full snapshot", zap.String("policy", policy), zap.String("run", run.Id),
+		zap.Any("tables", dbRun.Expected))
+}
+
+// LocateEndpoint returns the access ports where the endpoint mac address was learned
+func (ds *DiodeService) LocateEndpoint(macAddress string) ([]storage.DbEndpointLocation, error) {
+	return ds.storageService.GetEndpointLocations(macAddress, ds.config.Base.EndpointMaxMacs)
+}
+
+// GetValidationResults returns the assertion results of a validation policy, newest first
+func (ds *DiodeService) GetValidationResults(policy string) ([]storage.DbValidation, error) {
+	return ds.storageService.GetValidationsByPolicy(policy)
+}
+
+// GetDevicesByAgent returns the devices discovered by the agents matching the agent id and tags
+func (ds *DiodeService) GetDevicesByAgent(filter storage.AgentFilter) ([]storage.DbDevice, error) {
+	return ds.storageService.GetDevicesByAgent(filter)
+}
+
+// GetDeviceConfigs returns the running config versions of a device polled by an agent
+func (ds *DiodeService) GetDeviceConfigs(policy, namespace, hostname, agentId string) ([]storage.DbDeviceConfig, error) {
+	return ds.storageService.GetDeviceConfigsByPolicyAndNamespaceAndHostname(policy, namespace, hostname, agentId)
+}
+
+// GetDeviceConfigDiff returns the changes of a device config version from the previous one
+func (ds *DiodeService) GetDeviceConfigDiff(policy, namespace, hostname, agentId string, version int64) (string, error) {
+	return ds.storageService.GetDeviceConfigDiff(policy, namespace, hostname, agentId, version)
+}
+
 func (ds *DiodeService) Stop() error {
 	err := ds.otlpRecv.Stop()
 	if err != nil {
 		return err
 	}
-	return nil
+	return ds.stopServer()
 }
@@ -1,24 +1,93 @@
 package storage
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
 type Service interface {
-	Save(policy string, jsonData map[string]interface{}) (interface{}, error)
+	Save(policy string, agent AgentInfo, jsonData map[string]interface{}) (interface{}, error)
 	UpdateInterface(id string, netboxId int64) (DbInterface, error)
 	UpdateDevice(id string, netboxId int64) (DbDevice, error)
 	UpdateVlan(id string, netboxId int64) (DbVlan, error)
 	UpdateInventory(id string, netboxId int64) (DbInventory, error)
+	UpdateLldp(id string, netboxId int64) (DbLldp, error)
+	UpdateArpnd(id string, netboxId int64) (DbArpnd, error)
+	UpdateRoute(id string, netboxId int64) (DbRoute, error)
+	UpdateBgp(id string, netboxId int64) (DbBgp, error)
+	UpdateDeviceConfig(id string, netboxId int64) (DbDeviceConfig, error)
+	UpdateMac(id string, netboxId int64) (DbMac, error)
 	GetInterfacesByName(name string) ([]DbInterface, error)
 	GetInterfaceByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbInterface, error)
 	GetDevicesByHostname(hostname string) ([]DbDevice, error)
+	GetDevicesByAgent(filter AgentFilter) ([]DbDevice, error)
+	GetInterfacesByAgent(filter AgentFilter) ([]DbInterface, error)
 	GetDevicesByPolicyAndNamespace(policy, namespace string) ([]DbDevice, error)
 	GetDeviceByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) (DbDevice, error)
 	GetVlansByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbVlan, error)
 	GetInventoriesByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbInventory, error)
 	GetInventoriesByName(name string) ([]DbInventory, error)
+	GetLldpsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbLldp, error)
+	GetArpndsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbArpnd, error)
+	GetBgpsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbBgp, error)
+	GetDeviceConfigsByPolicyAndNamespaceAndHostname(policy, namespace, hostname, agentId string) ([]DbDeviceConfig, error)
+	GetDeviceConfigDiff(policy, namespace, hostname, agentId string, version int64) (string, error)
+	GetEndpointLocations(macAddress string, maxPortMacs int64) ([]DbEndpointLocation, error)
+	RemoveRecords(policy string, agent AgentInfo, table string, keys []map[string]string) (int64, error)
+	UpdateRun(policy string, run RunInfo, table string, count int64) (DbRun, error)
+	CompleteRun(policy string, run RunInfo, tables map[string]int64) (DbRun, error)
+	GetRun(id string) (DbRun, error)
+	GetPollErrorsByPolicy(policy string) ([]DbPollError, error)
+	GetValidationsByPolicy(policy string) ([]DbValidation, error)
+}
+
+// AgentInfo identifies the agent that discovered the records being saved
+type AgentInfo struct {
+	Id   string
+	Tags Tags
+	// Identity is the verified client certificate identity the records were received from
+	Identity string
+}
+
+// AgentFilter selects the records of an agent, or of the agents having all
+// the given tags. Empty fields match any agent
+type AgentFilter struct {
+	AgentId string
+	Tags    map[string]string
+}
+
+// Tags are the agent tags, stored as a json object
+type Tags map[string]string
+
+func (t Tags) Value() (driver.Value, error) {
+	if t == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+func (t *Tags) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case []byte:
+		return json.Unmarshal(v, t)
+	default:
+		return errors.New("storage tags parse fail, unsupported type")
+	}
 }
 
 type DbInterface struct {
 	Id          string      `json:"id,omitempty"`
 	Policy      string      `json:"policy,omitempty"`
+	AgentId     string      `json:"agent_id,omitempty"`
+	Tags        Tags        `json:"tags,omitempty"`
 	Config      interface{} `json:"config,omitempty"`
 	Namespace   string      `json:"namespace"`
 	Hostname    string      `json:"hostname"`
@@ -41,6 +110,8 @@ type IpAddress struct {
 type DbDevice struct {
 	Id           string      `json:"id,omitempty"`
 	Policy       string      `json:"policy,omitempty"`
+	AgentId      string      `json:"agent_id,omitempty"`
+	Tags         Tags        `json:"tags,omitempty"`
 	Config       interface{} `json:"config,omitempty"`
 	SerialNumber string      `json:"serialNumber"`
 	Namespace    string      `json:"namespace"`
@@ -57,6 +128,8 @@ type DbDevice struct {
 type DbVlan struct {
 	Id          string      `json:"id,omitempty"`
 	Policy      string      `json:"policy,omitempty"`
+	AgentId     string      `json:"agent_id,omitempty"`
+	Tags        Tags        `json:"tags,omitempty"`
 	Config      interface{} `json:"config,omitempty"`
 	Namespace   string      `json:"namespace"`
 	Hostname    string      `json:"hostname"`
@@ -69,6 +142,8 @@ type DbVlan struct {
 type DbInventory struct {
 	Id          string      `json:"id,omitempty"`
 	Policy      string      `json:"policy,omitempty"`
+	AgentId     string      `json:"agent_id,omitempty"`
+	Tags        Tags        `json:"tags,omitempty"`
 	Config      interface{} `json:"config,omitempty"`
 	Namespace   string      `json:"namespace"`
 	Hostname    string      `json:"hostname"`
@@ -81,3 +156,159 @@ type DbInventory struct {
 	NetboxRefId int64       `json:"netbox_id,omitempty"`
 	Blob        string      `json:"blob,omitempty"`
 }
+
+type DbLldp struct {
+	Id             string      `json:"id,omitempty"`
+	Policy         string      `json:"policy,omitempty"`
+	AgentId        string      `json:"agent_id,omitempty"`
+	Tags           Tags        `json:"tags,omitempty"`
+	Config         interface{} `json:"config,omitempty"`
+	Namespace      string      `json:"namespace"`
+	Hostname       string      `json:"hostname"`
+	Name           string      `json:"ifname"`
+	PeerHostname   string      `json:"peerHostname"`
+	PeerName       string      `json:"peerIfname"`
+	PeerMacAddress string      `json:"peerMacaddr"`
+	MgmtIp         string      `json:"mgmtIP"`
+	NetboxRefId    int64       `json:"netbox_id,omitempty"`
+	Blob           string      `json:"blob,omitempty"`
+}
+
+type DbArpnd struct {
+	Id          string      `json:"id,omitempty"`
+	Policy      string      `json:"policy,omitempty"`
+	AgentId     string      `json:"agent_id,omitempty"`
+	Tags        Tags        `json:"tags,omitempty"`
+	Config      interface{} `json:"config,omitempty"`
+	Namespace   string      `json:"namespace"`
+	Hostname    string      `json:"hostname"`
+	IpAddress   string      `json:"ipAddress"`
+	Interface   string      `json:"oif"`
+	MacAddress  string      `json:"macaddr"`
+	State       string      `json:"state"`
+	NetboxRefId int64       `json:"netbox_id,omitempty"`
+	Blob        string      `json:"blob,omitempty"`
+}
+
+type DbRoute struct {
+	Id          string      `json:"id,omitempty"`
+	Policy      string      `json:"policy,omitempty"`
+	AgentId     string      `json:"agent_id,omitempty"`
+	Tags        Tags        `json:"tags,omitempty"`
+	Config      interface{} `json:"config,omitempty"`
+	Namespace   string      `json:"namespace"`
+	Hostname    string      `json:"hostname"`
+	Vrf         string      `json:"vrf"`
+	Prefix      string      `json:"prefix"`
+	Protocol    string      `json:"protocol"`
+	NetboxRefId int64       `json:"netbox_id,omitempty"`
+	Blob        string      `json:"blob,omitempty"`
+}
+
+type DbBgp struct {
+	Id           string      `json:"id,omitempty"`
+	Policy       string      `json:"policy,omitempty"`
+	AgentId      string      `json:"agent_id,omitempty"`
+	Tags         Tags        `json:"tags,omitempty"`
+	Config       interface{} `json:"config,omitempty"`
+	Namespace    string      `json:"namespace"`
+	Hostname     string      `json:"hostname"`
+	Vrf          string      `json:"vrf"`
+	Peer         string      `json:"peer"`
+	PeerHostname string      `json:"peerHostname"`
+	State        string      `json:"state"`
+	Asn          int64       `json:"asn"`
+	PeerAsn      int64       `json:"peerAsn"`
+	Afi          string      `json:"afi"`
+	Safi         string      `json:"safi"`
+	NetboxRefId  int64       `json:"netbox_id,omitempty"`
+	Blob         string      `json:"blob,omitempty"`
+}
+
+// DbDeviceConfig is a version of a device running config, a new version is
+// only stored when the content hash changes
+type DbDeviceConfig struct {
+	Id           string      `json:"id,omitempty"`
+	Policy       string      `json:"policy,omitempty"`
+	AgentId      string      `json:"agent_id,omitempty"`
+	Tags         Tags        `json:"tags,omitempty"`
+	PolicyConfig interface{} `json:"policy_config,omitempty"`
+	Namespace    string      `json:"namespace"`
+	Hostname     string      `json:"hostname"`
+	Content      string      `json:"config"`
+	Version      int64       `json:"version"`
+	Hash         string      `json:"hash"`
+	CreatedAt    time.Time   `json:"created_at"`
+	NetboxRefId  int64       `json:"netbox_id,omitempty"`
+}
+
+type DbMac struct {
+	Id          string      `json:"id,omitempty"`
+	Policy      string      `json:"policy,omitempty"`
+	AgentId     string      `json:"agent_id,omitempty"`
+	Tags        Tags        `json:"tags,omitempty"`
+	Config      interface{} `json:"config,omitempty"`
+	Namespace   string      `json:"namespace"`
+	Hostname    string      `json:"hostname"`
+	Vlan        int64       `json:"vlan"`
+	MacAddress  string      `json:"macaddr"`
+	Interface   string      `json:"oif"`
+	NetboxRefId int64       `json:"netbox_id,omitempty"`
+	Blob        string      `json:"blob,omitempty"`
+}
+
+// DbEndpointLocation is the access port an endpoint mac address was learned on
+type DbEndpointLocation struct {
+	Policy            string `json:"policy"`
+	AgentId           string `json:"agent_id,omitempty"`
+	Namespace         string `json:"namespace"`
+	Hostname          string `json:"hostname"`
+	Interface         string `json:"ifname"`
+	Vlan              int64  `json:"vlan"`
+	MacAddress        string `json:"macaddr"`
+	InterfaceNetboxId int64  `json:"interface_netbox_id"`
+}
+
+type DbPollError struct {
+	Id        string    `json:"id,omitempty"`
+	Policy    string    `json:"policy,omitempty"`
+	AgentId   string    `json:"agent_id,omitempty"`
+	Tags      Tags      `json:"tags,omitempty"`
+	Namespace string    `json:"namespace"`
+	Hostname  string    `json:"hostname"`
+	Service   string    `json:"service"`
+	Status    int64     `json:"status"`
+	Category  string    `json:"category"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type DbValidation struct {
+	Id        string                 `json:"id,omitempty"`
+	Policy    string                 `json:"policy,omitempty"`
+	AgentId   string                 `json:"agent_id,omitempty"`
+	Tags      Tags                   `json:"tags,omitempty"`
+	Assertion string                 `json:"assertion"`
+	Namespace string                 `json:"namespace"`
+	Hostname  string                 `json:"hostname"`
+	Result    string                 `json:"result"`
+	Reasons   []string               `json:"reasons,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+type RunInfo struct {
+	Id        string    `json:"id"`
+	Sequence  int64     `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type DbRun struct {
+	Id          string           `json:"id"`
+	Policy      string           `json:"policy"`
+	Fragments   int64            `json:"fragments"`
+	Received    map[string]int64 `json:"received"`
+	Expected    map[string]int64 `json:"expected,omitempty"`
+	StartedAt   time.Time        `json:"started_at"`
+	CompletedAt time.Time        `json:"completed_at,omitempty"`
+	Complete    bool             `json:"complete"`
+}
@@ -1,12 +1,18 @@
 package storage
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/pmezard/go-difflib/difflib"
 	"go.uber.org/zap"
 	"golang.org/x/exp/slices"
 )
@@ -28,7 +34,7 @@ func NewSqliteStorage(logger *zap.Logger) (Service, error) {
 
 func (s sqliteStorage) GetInterfacesByName(name string) ([]DbInterface, error) {
 	selectResult, err := s.db.Query(`
-		SELECT id, policy, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
 		FROM interfaces
 		WHERE name = $1
 	`, name)
@@ -40,7 +46,7 @@ func (s sqliteStorage) GetInterfacesByName(name string) ([]DbInterface, error) {
 	var ipsAsString string
 	for selectResult.Next() {
 		var iface DbInterface
-		err := selectResult.Scan(&iface.Id, &iface.Policy, &configAsString, &iface.Namespace, &iface.Hostname, &iface.Name, &iface.AdminState,
+		err := selectResult.Scan(&iface.Id, &iface.Policy, &iface.AgentId, &iface.Tags, &configAsString, &iface.Namespace, &iface.Hostname, &iface.Name, &iface.AdminState,
 			&iface.Mtu, &iface.Speed, &iface.MacAddress, &iface.IfType, &iface.NetboxRefId, &ipsAsString, &iface.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage ifce struct fail"), err)
@@ -62,7 +68,7 @@ func (s sqliteStorage) GetInterfacesByName(name string) ([]DbInterface, error) {
 
 func (s sqliteStorage) GetInterfaceByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbInterface, error) {
 	selectResult, err := s.db.Query(`
-		SELECT id, policy, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
 		FROM interfaces
 		WHERE policy = $1 AND namespace = $2 AND hostname = $3
 	`, policy, namespace, hostname)
@@ -74,7 +80,7 @@ func (s sqliteStorage) GetInterfaceByPolicyAndNamespaceAndHostname(policy, names
 	var ipsAsString string
 	for selectResult.Next() {
 		var iface DbInterface
-		err := selectResult.Scan(&iface.Id, &iface.Policy, &configAsString, &iface.Namespace, &iface.Hostname, &iface.Name, &iface.AdminState,
+		err := selectResult.Scan(&iface.Id, &iface.Policy, &iface.AgentId, &iface.Tags, &configAsString, &iface.Namespace, &iface.Hostname, &iface.Name, &iface.AdminState,
 			&iface.Mtu, &iface.Speed, &iface.MacAddress, &iface.IfType, &iface.NetboxRefId, &ipsAsString, &iface.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage ifce struct fail"), err)
@@ -97,7 +103,7 @@ func (s sqliteStorage) GetInterfaceByPolicyAndNamespaceAndHostname(policy, names
 
 func (s sqliteStorage) GetDevicesByHostname(hostname string) ([]DbDevice, error) {
 	selectResult, err := s.db.Query(`
-	SELECT id, policy, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
+	SELECT id, policy, agent_id, tags, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
 	FROM devices
 	WHERE hostname = $1`, hostname)
 	if err != nil {
@@ -107,7 +113,7 @@ func (s sqliteStorage) GetDevicesByHostname(hostname string) ([]DbDevice, error)
 	var configAsString string
 	for selectResult.Next() {
 		var device DbDevice
-		err := selectResult.Scan(&device.Id, &device.Policy, &configAsString, &device.Namespace, &device.Hostname, &device.SerialNumber,
+		err := selectResult.Scan(&device.Id, &device.Policy, &device.AgentId, &device.Tags, &configAsString, &device.Namespace, &device.Hostname, &device.SerialNumber,
 			&device.Model, &device.State, &device.Vendor, &device.Os, &device.NetboxRefId, &device.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage create device struct fail on NEW REPO FUNC"), err)
@@ -123,9 +129,98 @@ func (s sqliteStorage) GetDevicesByHostname(hostname string) ([]DbDevice, error)
 	return devices, nil
 }
 
+// GetDevicesByAgent returns the devices discovered by the agents matching the filter
+func (s sqliteStorage) GetDevicesByAgent(filter AgentFilter) ([]DbDevice, error) {
+	where, args := agentFilterClause(filter)
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
+		FROM devices
+		`+where, args...)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch device fail"), err)
+	}
+	var devices []DbDevice
+	var configAsString string
+	for selectResult.Next() {
+		var device DbDevice
+		err := selectResult.Scan(&device.Id, &device.Policy, &device.AgentId, &device.Tags, &configAsString, &device.Namespace,
+			&device.Hostname, &device.SerialNumber, &device.Model, &device.State, &device.Vendor, &device.Os, &device.NetboxRefId, &device.Blob)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create device struct fail"), err)
+		}
+		if len(configAsString) > 0 {
+			err = json.Unmarshal([]byte(configAsString), &device.Config)
+			if err != nil {
+				return nil, errors.Join(errors.New("storage config parse fail"), err)
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// GetInterfacesByAgent returns the interfaces discovered by the agents matching the filter
+func (s sqliteStorage) GetInterfacesByAgent(filter AgentFilter) ([]DbInterface, error) {
+	where, args := agentFilterClause(filter)
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
+		FROM interfaces
+		`+where, args...)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch interface fail"), err)
+	}
+	var interfaces []DbInterface
+	var configAsString string
+	var ipsAsString string
+	for selectResult.Next() {
+		var iface DbInterface
+		err := selectResult.Scan(&iface.Id, &iface.Policy, &iface.AgentId, &iface.Tags, &configAsString, &iface.Namespace, &iface.Hostname,
+			&iface.Name, &iface.AdminState, &iface.Mtu, &iface.Speed, &iface.MacAddress, &iface.IfType, &iface.NetboxRefId, &ipsAsString, &iface.Blob)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage ifce struct fail"), err)
+		}
+		if len(configAsString) > 0 {
+			err = json.Unmarshal([]byte(configAsString), &iface.Config)
+			if err != nil {
+				return nil, errors.Join(errors.New("storage config parse fail"), err)
+			}
+		}
+		err = json.Unmarshal([]byte(ipsAsString), &iface.IpAddresses)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage ip_address parse fail"), err)
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// agentFilterClause builds the where clause matching the agent id and every tag of the filter
+func agentFilterClause(filter AgentFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if filter.AgentId != "" {
+		args = append(args, filter.AgentId)
+		conditions = append(conditions, fmt.Sprintf("agent_id = $%d", len(args)))
+	}
+	keys := make([]string, 0, len(filter.Tags))
+	for k := range filter.Tags {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		args = append(args, k, filter.Tags[k])
+		conditions = append(conditions,
+			fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(tags) WHERE key = $%d AND value = $%d)", len(args)-1, len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
 func (s sqliteStorage) GetDevicesByPolicyAndNamespace(policy, namespace string) ([]DbDevice, error) {
 	selectResult, err := s.db.Query(`
-		SELECT id, policy, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
 		FROM devices
 		WHERE policy = $1 AND namespace = $2
 	`, policy, namespace)
@@ -136,7 +231,7 @@ func (s sqliteStorage) GetDevicesByPolicyAndNamespace(policy, namespace string)
 	var configAsString string
 	for selectResult.Next() {
 		var device DbDevice
-		err := selectResult.Scan(&device.Id, &device.Policy, &configAsString, &device.Namespace, &device.Hostname, &device.SerialNumber,
+		err := selectResult.Scan(&device.Id, &device.Policy, &device.AgentId, &device.Tags, &configAsString, &device.Namespace, &device.Hostname, &device.SerialNumber,
 			&device.Model, &device.State, &device.Vendor, &device.Os, &device.NetboxRefId, &device.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage create device struct fail"), err)
@@ -154,13 +249,13 @@ func (s sqliteStorage) GetDevicesByPolicyAndNamespace(policy, namespace string)
 
 func (s sqliteStorage) GetDeviceByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) (DbDevice, error) {
 	selectResult := s.db.QueryRow(`
-		SELECT id, policy, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, serial_number, model, state, vendor, os, netbox_id, json_data
 		FROM devices
 		WHERE policy = $1 AND namespace = $2 AND hostname = $3
 	`, policy, namespace, hostname)
 	var device DbDevice
 	var configAsString string
-	err := selectResult.Scan(&device.Id, &device.Policy, &configAsString, &device.Namespace, &device.Hostname, &device.SerialNumber,
+	err := selectResult.Scan(&device.Id, &device.Policy, &device.AgentId, &device.Tags, &configAsString, &device.Namespace, &device.Hostname, &device.SerialNumber,
 		&device.Model, &device.State, &device.Vendor, &device.Os, &device.NetboxRefId, &device.Blob)
 	if err != nil {
 		return DbDevice{}, errors.Join(errors.New("storage fetch device fail"), err)
@@ -176,7 +271,7 @@ func (s sqliteStorage) GetDeviceByPolicyAndNamespaceAndHostname(policy, namespac
 
 func (s sqliteStorage) GetVlansByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbVlan, error) {
 	selectResult, err := s.db.Query(`
-		SELECT id, policy, config, namespace, hostname, name, state, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, state, netbox_id, json_data
 		FROM vlans
 		WHERE policy = $1 AND namespace = $2 AND hostname = $3
 	`, policy, namespace, hostname)
@@ -187,7 +282,7 @@ func (s sqliteStorage) GetVlansByPolicyAndNamespaceAndHostname(policy, namespace
 	var configAsString string
 	for selectResult.Next() {
 		var vlan DbVlan
-		err := selectResult.Scan(&vlan.Id, &vlan.Policy, &configAsString, &vlan.Namespace, &vlan.Hostname, &vlan.Name,
+		err := selectResult.Scan(&vlan.Id, &vlan.Policy, &vlan.AgentId, &vlan.Tags, &configAsString, &vlan.Namespace, &vlan.Hostname, &vlan.Name,
 			&vlan.State, &vlan.NetboxRefId, &vlan.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage create vlan struct fail"), err)
@@ -206,7 +301,7 @@ func (s sqliteStorage) GetVlansByPolicyAndNamespaceAndHostname(policy, namespace
 
 func (s sqliteStorage) GetInventoriesByName(name string) ([]DbInventory, error) {
 	selectResult, err := s.db.Query(`
-	SELECT id, policy, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data
+	SELECT id, policy, agent_id, tags, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data
 	FROM inventories
 	WHERE name = $1
 	`, name)
@@ -217,7 +312,7 @@ func (s sqliteStorage) GetInventoriesByName(name string) ([]DbInventory, error)
 	var configAsString string
 	for selectResult.Next() {
 		var inventory DbInventory
-		err := selectResult.Scan(&inventory.Id, &inventory.Policy, &configAsString, &inventory.Namespace, &inventory.Hostname, &inventory.Name,
+		err := selectResult.Scan(&inventory.Id, &inventory.Policy, &inventory.AgentId, &inventory.Tags, &configAsString, &inventory.Namespace, &inventory.Hostname, &inventory.Name,
 			&inventory.Descr, &inventory.Vendor, &inventory.Serial, &inventory.PartNum, &inventory.Type, &inventory.NetboxRefId, &inventory.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage create inventory struct fail"), err)
@@ -235,7 +330,7 @@ func (s sqliteStorage) GetInventoriesByName(name string) ([]DbInventory, error)
 
 func (s sqliteStorage) GetInventoriesByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbInventory, error) {
 	selectResult, err := s.db.Query(`
-		SELECT id, policy, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data
 		FROM inventories
 		WHERE policy = $1 AND namespace = $2 AND hostname = $3
 	`, policy, namespace, hostname)
@@ -246,7 +341,7 @@ func (s sqliteStorage) GetInventoriesByPolicyAndNamespaceAndHostname(policy, nam
 	var configAsString string
 	for selectResult.Next() {
 		var inventory DbInventory
-		err := selectResult.Scan(&inventory.Id, &inventory.Policy, &configAsString, &inventory.Namespace, &inventory.Hostname, &inventory.Name,
+		err := selectResult.Scan(&inventory.Id, &inventory.Policy, &inventory.AgentId, &inventory.Tags, &configAsString, &inventory.Namespace, &inventory.Hostname, &inventory.Name,
 			&inventory.Descr, &inventory.Vendor, &inventory.Serial, &inventory.PartNum, &inventory.Type, &inventory.NetboxRefId, &inventory.Blob)
 		if err != nil {
 			return nil, errors.Join(errors.New("storage create inventory struct fail"), err)
@@ -263,6 +358,192 @@ func (s sqliteStorage) GetInventoriesByPolicyAndNamespaceAndHostname(policy, nam
 	return inventories, nil
 }
 
+func (s sqliteStorage) GetLldpsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbLldp, error) {
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, peer_hostname, peer_name, peer_mac_address, mgmt_ip, netbox_id, json_data
+		FROM lldp
+		WHERE policy = $1 AND namespace = $2 AND hostname = $3
+	`, policy, namespace, hostname)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch lldp fail"), err)
+	}
+	var lldps []DbLldp
+	var configAsString string
+	for selectResult.Next() {
+		var lldp DbLldp
+		err := selectResult.Scan(&lldp.Id, &lldp.Policy, &lldp.AgentId, &lldp.Tags, &configAsString, &lldp.Namespace, &lldp.Hostname, &lldp.Name,
+			&lldp.PeerHostname, &lldp.PeerName, &lldp.PeerMacAddress, &lldp.MgmtIp, &lldp.NetboxRefId, &lldp.Blob)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create lldp struct fail"), err)
+		}
+		if len(configAsString) > 0 {
+			err = json.Unmarshal([]byte(configAsString), &lldp.Config)
+			if err != nil {
+				return nil, errors.Join(errors.New("storage config parse fail"), err)
+			}
+		}
+		lldps = append(lldps, lldp)
+	}
+	return lldps, nil
+}
+
+func (s sqliteStorage) GetArpndsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbArpnd, error) {
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, ip_address, interface, mac_address, state, netbox_id, json_data
+		FROM arpnd
+		WHERE policy = $1 AND namespace = $2 AND hostname = $3
+	`, policy, namespace, hostname)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch arpnd fail"), err)
+	}
+	var arpnds []DbArpnd
+	var configAsString string
+	for selectResult.Next() {
+		var arpnd DbArpnd
+		err := selectResult.Scan(&arpnd.Id, &arpnd.Policy, &arpnd.AgentId, &arpnd.Tags, &configAsString, &arpnd.Namespace, &arpnd.Hostname,
+			&arpnd.IpAddress, &arpnd.Interface, &arpnd.MacAddress, &arpnd.State, &arpnd.NetboxRefId, &arpnd.Blob)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create arpnd struct fail"), err)
+		}
+		if len(configAsString) > 0 {
+			err = json.Unmarshal([]byte(configAsString), &arpnd.Config)
+			if err != nil {
+				return nil, errors.Join(errors.New("storage config parse fail"), err)
+			}
+		}
+		arpnds = append(arpnds, arpnd)
+	}
+	return arpnds, nil
+}
+
+func (s sqliteStorage) GetBgpsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]DbBgp, error) {
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, vrf, peer, peer_hostname, state, asn, peer_asn, afi, safi, netbox_id, json_data
+		FROM bgp
+		WHERE policy = $1 AND namespace = $2 AND hostname = $3
+	`, policy, namespace, hostname)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch bgp fail"), err)
+	}
+	var bgps []DbBgp
+	var configAsString string
+	for selectResult.Next() {
+		var bgp DbBgp
+		err := selectResult.Scan(&bgp.Id, &bgp.Policy, &bgp.AgentId, &bgp.Tags, &configAsString, &bgp.Namespace, &bgp.Hostname, &bgp.Vrf, &bgp.Peer,
+			&bgp.PeerHostname, &bgp.State, &bgp.Asn, &bgp.PeerAsn, &bgp.Afi, &bgp.Safi, &bgp.NetboxRefId, &bgp.Blob)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create bgp struct fail"), err)
+		}
+		if len(configAsString) > 0 {
+			err = json.Unmarshal([]byte(configAsString), &bgp.Config)
+			if err != nil {
+				return nil, errors.Join(errors.New("storage config parse fail"), err)
+			}
+		}
+		bgps = append(bgps, bgp)
+	}
+	return bgps, nil
+}
+
+// GetDeviceConfigsByPolicyAndNamespaceAndHostname returns the config versions of
+// a device, which are numbered per agent polling it
+func (s sqliteStorage) GetDeviceConfigsByPolicyAndNamespaceAndHostname(policy, namespace, hostname, agentId string) ([]DbDeviceConfig, error) {
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, content, version, hash, created_at, netbox_id
+		FROM device_configs
+		WHERE policy = $1 AND namespace = $2 AND hostname = $3 AND agent_id = $4
+		ORDER BY version
+	`, policy, namespace, hostname, agentId)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch device configs fail"), err)
+	}
+	var devConfigs []DbDeviceConfig
+	var configAsString string
+	for selectResult.Next() {
+		var devConfig DbDeviceConfig
+		err := selectResult.Scan(&devConfig.Id, &devConfig.Policy, &devConfig.AgentId, &devConfig.Tags, &configAsString, &devConfig.Namespace, &devConfig.Hostname,
+			&devConfig.Content, &devConfig.Version, &devConfig.Hash, &devConfig.CreatedAt, &devConfig.NetboxRefId)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create device config struct fail"), err)
+		}
+		if len(configAsString) > 0 {
+			err = json.Unmarshal([]byte(configAsString), &devConfig.PolicyConfig)
+			if err != nil {
+				return nil, errors.Join(errors.New("storage config parse fail"), err)
+			}
+		}
+		devConfigs = append(devConfigs, devConfig)
+	}
+	return devConfigs, nil
+}
+
+// GetDeviceConfigDiff returns the unified diff between a device config version
+// and the one preceding it, the first version being compared to an empty config
+func (s sqliteStorage) GetDeviceConfigDiff(policy, namespace, hostname, agentId string, version int64) (string, error) {
+	devConfigs, err := s.GetDeviceConfigsByPolicyAndNamespaceAndHostname(policy, namespace, hostname, agentId)
+	if err != nil {
+		return "", err
+	}
+	var previous, current *DbDeviceConfig
+	for i := range devConfigs {
+		switch devConfigs[i].Version {
+		case version - 1:
+			previous = &devConfigs[i]
+		case version:
+			current = &devConfigs[i]
+		}
+	}
+	if current == nil {
+		return "", fmt.Errorf("storage device config version %d not found", version)
+	}
+	diff := difflib.UnifiedDiff{
+		B:        difflib.SplitLines(current.Content),
+		ToFile:   fmt.Sprintf("%s version %d", hostname, current.Version),
+		FromFile: fmt.Sprintf("%s version %d", hostname, version-1),
+		Context:  3,
+	}
+	if previous != nil {
+		diff.A = difflib.SplitLines(previous.Content)
+	}
+	return difflib.GetUnifiedDiffString(diff)
+}
+
+// GetEndpointLocations looks up the access ports a mac address was learned on.
+// Ports with lldp neighbors or more than maxPortMacs addresses are uplinks or
+// trunks, where the mac is only in transit, so they are left out
+func (s sqliteStorage) GetEndpointLocations(macAddress string, maxPortMacs int64) ([]DbEndpointLocation, error) {
+	selectResult, err := s.db.Query(`
+		SELECT m.policy, m.agent_id, m.namespace, m.hostname, m.interface, m.vlan, m.mac_address, COALESCE(i.netbox_id, -1)
+		FROM macs m
+		LEFT JOIN interfaces i
+			ON i.agent_id = m.agent_id AND i.policy = m.policy AND i.namespace = m.namespace AND i.hostname = m.hostname
+				AND i.name = m.interface
+		WHERE m.mac_address = $1 AND m.interface != ''
+			AND NOT EXISTS (
+				SELECT 1 FROM lldp l
+				WHERE l.agent_id = m.agent_id AND l.policy = m.policy AND l.namespace = m.namespace AND l.hostname = m.hostname
+					AND l.name = m.interface)
+			AND (
+				SELECT COUNT(DISTINCT c.mac_address) FROM macs c
+				WHERE c.agent_id = m.agent_id AND c.policy = m.policy AND c.namespace = m.namespace AND c.hostname = m.hostname
+					AND c.interface = m.interface) <= $2
+	`, strings.ToLower(macAddress), maxPortMacs)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch endpoint locations fail"), err)
+	}
+	var locations []DbEndpointLocation
+	for selectResult.Next() {
+		var location DbEndpointLocation
+		err := selectResult.Scan(&location.Policy, &location.AgentId, &location.Namespace, &location.Hostname, &location.Interface,
+			&location.Vlan, &location.MacAddress, &location.InterfaceNetboxId)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create endpoint location struct fail"), err)
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
 func (s sqliteStorage) UpdateInterface(id string, netboxId int64) (DbInterface, error) {
 	_, err := s.db.Exec(`
 	UPDATE interfaces SET netbox_id = $1 WHERE id = $2`, netboxId, id)
@@ -270,14 +551,14 @@ func (s sqliteStorage) UpdateInterface(id string, netboxId int64) (DbInterface,
 		return DbInterface{}, errors.Join(errors.New("storage update interface fail"), err)
 	}
 	selectResult := s.db.QueryRow(`
-		SELECT id, policy, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, netbox_id, ip_addresses, json_data
 		FROM interfaces
 		WHERE id = $1
 	`, id)
 	var dbInterface DbInterface
 	var configAsString string
 	var ipsAsString string
-	err = selectResult.Scan(&dbInterface.Id, &dbInterface.Policy, &configAsString, &dbInterface.Namespace, &dbInterface.Hostname,
+	err = selectResult.Scan(&dbInterface.Id, &dbInterface.Policy, &dbInterface.AgentId, &dbInterface.Tags, &configAsString, &dbInterface.Namespace, &dbInterface.Hostname,
 		&dbInterface.Name, &dbInterface.AdminState, &dbInterface.Mtu, &dbInterface.Speed, &dbInterface.MacAddress,
 		&dbInterface.IfType, &dbInterface.NetboxRefId, &ipsAsString, &dbInterface.Blob)
 	if err != nil {
@@ -303,12 +584,12 @@ func (s sqliteStorage) UpdateDevice(id string, netboxId int64) (DbDevice, error)
 		return DbDevice{}, errors.Join(errors.New("storage update device fail"), err)
 	}
 	selectResult := s.db.QueryRow(`
-		SELECT id, policy, config, namespace, hostname, address, serial_number, model, state, vendor, os, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, address, serial_number, model, state, vendor, os, netbox_id, json_data
 		FROM devices
 		WHERE id = $1`, id)
 	var device DbDevice
 	var configAsString string
-	err = selectResult.Scan(&device.Id, &device.Policy, &configAsString, &device.Namespace, &device.Hostname, &device.Address, &device.SerialNumber,
+	err = selectResult.Scan(&device.Id, &device.Policy, &device.AgentId, &device.Tags, &configAsString, &device.Namespace, &device.Hostname, &device.Address, &device.SerialNumber,
 		&device.Model, &device.State, &device.Vendor, &device.Os, &device.NetboxRefId, &device.Blob)
 	if err != nil {
 		return DbDevice{}, errors.Join(errors.New("storage create device struct fail"), err)
@@ -329,12 +610,12 @@ func (s sqliteStorage) UpdateVlan(id string, netboxId int64) (DbVlan, error) {
 		return DbVlan{}, errors.Join(errors.New("storage update vlan fail"), err)
 	}
 	selectResult := s.db.QueryRow(`
-		SELECT id, policy, config, namespace, hostname, name, state, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, state, netbox_id, json_data
 		FROM vlans
 		WHERE id = $1`, id)
 	var vlan DbVlan
 	var configAsString string
-	err = selectResult.Scan(&vlan.Id, &vlan.Policy, &configAsString, &vlan.Namespace, &vlan.Hostname,
+	err = selectResult.Scan(&vlan.Id, &vlan.Policy, &vlan.AgentId, &vlan.Tags, &configAsString, &vlan.Namespace, &vlan.Hostname,
 		&vlan.Name, &vlan.State, &vlan.NetboxRefId, &vlan.Blob)
 	if err != nil {
 		return DbVlan{}, errors.Join(errors.New("storage create vlan struct fail"), err)
@@ -355,12 +636,12 @@ func (s sqliteStorage) UpdateInventory(id string, netboxId int64) (DbInventory,
 		return DbInventory{}, errors.Join(errors.New("storage update inventory fail"), err)
 	}
 	selectResult := s.db.QueryRow(`
-		SELECT id, policy, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data
 		FROM inventories
 		WHERE id = $1`, id)
 	var inventory DbInventory
 	var configAsString string
-	err = selectResult.Scan(&inventory.Id, &inventory.Policy, &configAsString, &inventory.Namespace, &inventory.Hostname, &inventory.Name,
+	err = selectResult.Scan(&inventory.Id, &inventory.Policy, &inventory.AgentId, &inventory.Tags, &configAsString, &inventory.Namespace, &inventory.Hostname, &inventory.Name,
 		&inventory.Descr, &inventory.Vendor, &inventory.Serial, &inventory.PartNum, &inventory.Type, &inventory.NetboxRefId, &inventory.Blob)
 	if err != nil {
 		return DbInventory{}, errors.Join(errors.New("storage create inventory struct fail"), err)
@@ -374,28 +655,694 @@ func (s sqliteStorage) UpdateInventory(id string, netboxId int64) (DbInventory,
 	return inventory, nil
 }
 
-func (s sqliteStorage) Save(policy string, jsonData map[string]interface{}) (stored interface{}, err error) {
+func (s sqliteStorage) UpdateLldp(id string, netboxId int64) (DbLldp, error) {
+	_, err := s.db.Exec(`
+	UPDATE lldp SET netbox_id = $1 WHERE id = $2`, netboxId, id)
+	if err != nil {
+		return DbLldp{}, errors.Join(errors.New("storage update lldp fail"), err)
+	}
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, name, peer_hostname, peer_name, peer_mac_address, mgmt_ip, netbox_id, json_data
+		FROM lldp
+		WHERE id = $1`, id)
+	var lldp DbLldp
+	var configAsString string
+	err = selectResult.Scan(&lldp.Id, &lldp.Policy, &lldp.AgentId, &lldp.Tags, &configAsString, &lldp.Namespace, &lldp.Hostname, &lldp.Name,
+		&lldp.PeerHostname, &lldp.PeerName, &lldp.PeerMacAddress, &lldp.MgmtIp, &lldp.NetboxRefId, &lldp.Blob)
+	if err != nil {
+		return DbLldp{}, errors.Join(errors.New("storage create lldp struct fail"), err)
+	}
+	if len(configAsString) > 0 {
+		err = json.Unmarshal([]byte(configAsString), &lldp.Config)
+		if err != nil {
+			return DbLldp{}, errors.Join(errors.New("storage config parse fail"), err)
+		}
+	}
+	return lldp, nil
+}
+
+func (s sqliteStorage) UpdateArpnd(id string, netboxId int64) (DbArpnd, error) {
+	_, err := s.db.Exec(`
+	UPDATE arpnd SET netbox_id = $1 WHERE id = $2`, netboxId, id)
+	if err != nil {
+		return DbArpnd{}, errors.Join(errors.New("storage update arpnd fail"), err)
+	}
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, ip_address, interface, mac_address, state, netbox_id, json_data
+		FROM arpnd
+		WHERE id = $1`, id)
+	var arpnd DbArpnd
+	var configAsString string
+	err = selectResult.Scan(&arpnd.Id, &arpnd.Policy, &arpnd.AgentId, &arpnd.Tags, &configAsString, &arpnd.Namespace, &arpnd.Hostname,
+		&arpnd.IpAddress, &arpnd.Interface, &arpnd.MacAddress, &arpnd.State, &arpnd.NetboxRefId, &arpnd.Blob)
+	if err != nil {
+		return DbArpnd{}, errors.Join(errors.New("storage create arpnd struct fail"), err)
+	}
+	if len(configAsString) > 0 {
+		err = json.Unmarshal([]byte(configAsString), &arpnd.Config)
+		if err != nil {
+			return DbArpnd{}, errors.Join(errors.New("storage config parse fail"), err)
+		}
+	}
+	return arpnd, nil
+}
+
+func (s sqliteStorage) UpdateRoute(id string, netboxId int64) (DbRoute, error) {
+	_, err := s.db.Exec(`
+	UPDATE routes SET netbox_id = $1 WHERE id = $2`, netboxId, id)
+	if err != nil {
+		return DbRoute{}, errors.Join(errors.New("storage update route fail"), err)
+	}
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, vrf, prefix, protocol, netbox_id, json_data
+		FROM routes
+		WHERE id = $1`, id)
+	var route DbRoute
+	var configAsString string
+	err = selectResult.Scan(&route.Id, &route.Policy, &route.AgentId, &route.Tags, &configAsString, &route.Namespace, &route.Hostname,
+		&route.Vrf, &route.Prefix, &route.Protocol, &route.NetboxRefId, &route.Blob)
+	if err != nil {
+		return DbRoute{}, errors.Join(errors.New("storage create route struct fail"), err)
+	}
+	if len(configAsString) > 0 {
+		err = json.Unmarshal([]byte(configAsString), &route.Config)
+		if err != nil {
+			return DbRoute{}, errors.Join(errors.New("storage config parse fail"), err)
+		}
+	}
+	return route, nil
+}
+
+func (s sqliteStorage) UpdateBgp(id string, netboxId int64) (DbBgp, error) {
+	_, err := s.db.Exec(`
+	UPDATE bgp SET netbox_id = $1 WHERE id = $2`, netboxId, id)
+	if err != nil {
+		return DbBgp{}, errors.Join(errors.New("storage update bgp fail"), err)
+	}
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, vrf, peer, peer_hostname, state, asn, peer_asn, afi, safi, netbox_id, json_data
+		FROM bgp
+		WHERE id = $1`, id)
+	var bgp DbBgp
+	var configAsString string
+	err = selectResult.Scan(&bgp.Id, &bgp.Policy, &bgp.AgentId, &bgp.Tags, &configAsString, &bgp.Namespace, &bgp.Hostname, &bgp.Vrf, &bgp.Peer,
+		&bgp.PeerHostname, &bgp.State, &bgp.Asn, &bgp.PeerAsn, &bgp.Afi, &bgp.Safi, &bgp.NetboxRefId, &bgp.Blob)
+	if err != nil {
+		return DbBgp{}, errors.Join(errors.New("storage create bgp struct fail"), err)
+	}
+	if len(configAsString) > 0 {
+		err = json.Unmarshal([]byte(configAsString), &bgp.Config)
+		if err != nil {
+			return DbBgp{}, errors.Join(errors.New("storage config parse fail"), err)
+		}
+	}
+	return bgp, nil
+}
+
+func (s sqliteStorage) UpdateDeviceConfig(id string, netboxId int64) (DbDeviceConfig, error) {
+	_, err := s.db.Exec(`
+	UPDATE device_configs SET netbox_id = $1 WHERE id = $2`, netboxId, id)
+	if err != nil {
+		return DbDeviceConfig{}, errors.Join(errors.New("storage update device config fail"), err)
+	}
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, content, version, hash, created_at, netbox_id
+		FROM device_configs
+		WHERE id = $1`, id)
+	var devConfig DbDeviceConfig
+	var configAsString string
+	err = selectResult.Scan(&devConfig.Id, &devConfig.Policy, &devConfig.AgentId, &devConfig.Tags, &configAsString, &devConfig.Namespace, &devConfig.Hostname,
+		&devConfig.Content, &devConfig.Version, &devConfig.Hash, &devConfig.CreatedAt, &devConfig.NetboxRefId)
+	if err != nil {
+		return DbDeviceConfig{}, errors.Join(errors.New("storage create device config struct fail"), err)
+	}
+	if len(configAsString) > 0 {
+		err = json.Unmarshal([]byte(configAsString), &devConfig.PolicyConfig)
+		if err != nil {
+			return DbDeviceConfig{}, errors.Join(errors.New("storage config parse fail"), err)
+		}
+	}
+	return devConfig, nil
+}
+
+func (s sqliteStorage) UpdateMac(id string, netboxId int64) (DbMac, error) {
+	_, err := s.db.Exec(`
+	UPDATE macs SET netbox_id = $1 WHERE id = $2`, netboxId, id)
+	if err != nil {
+		return DbMac{}, errors.Join(errors.New("storage update mac fail"), err)
+	}
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, agent_id, tags, config, namespace, hostname, vlan, mac_address, interface, netbox_id, json_data
+		FROM macs
+		WHERE id = $1`, id)
+	var mac DbMac
+	var configAsString string
+	err = selectResult.Scan(&mac.Id, &mac.Policy, &mac.AgentId, &mac.Tags, &configAsString, &mac.Namespace, &mac.Hostname, &mac.Vlan, &mac.MacAddress,
+		&mac.Interface, &mac.NetboxRefId, &mac.Blob)
+	if err != nil {
+		return DbMac{}, errors.Join(errors.New("storage create mac struct fail"), err)
+	}
+	if len(configAsString) > 0 {
+		err = json.Unmarshal([]byte(configAsString), &mac.Config)
+		if err != nil {
+			return DbMac{}, errors.Join(errors.New("storage config parse fail"), err)
+		}
+	}
+	return mac, nil
+}
+
+func (s sqliteStorage) Save(policy string, agent AgentInfo, jsonData map[string]interface{}) (stored interface{}, err error) {
 	confData := jsonData["config"]
 	data, ok := jsonData["interfaces"].([]interface{})
 	if ok {
-		return s.saveInterfaces(policy, confData, data, err)
+		return s.saveInterfaces(policy, agent, confData, data, err)
 	}
 	data, ok = jsonData["device"].([]interface{})
 	if ok {
-		return s.saveDevices(policy, confData, data, err)
+		return s.saveDevices(policy, agent, confData, data, err)
 	}
 	data, ok = jsonData["vlan"].([]interface{})
 	if ok {
-		return s.saveVlans(policy, confData, data, err)
+		return s.saveVlans(policy, agent, confData, data, err)
 	}
 	data, ok = jsonData["inventory"].([]interface{})
 	if ok {
-		return s.saveInventories(policy, confData, data, err)
+		return s.saveInventories(policy, agent, confData, data, err)
+	}
+	data, ok = jsonData["lldp"].([]interface{})
+	if ok {
+		return s.saveLldps(policy, agent, confData, data)
+	}
+	data, ok = jsonData["arpnd"].([]interface{})
+	if ok {
+		return s.saveArpnds(policy, agent, confData, data)
+	}
+	data, ok = jsonData["routes"].([]interface{})
+	if ok {
+		return s.saveRoutes(policy, agent, confData, data)
+	}
+	data, ok = jsonData["bgp"].([]interface{})
+	if ok {
+		return s.saveBgps(policy, agent, confData, data)
+	}
+	data, ok = jsonData["devconfig"].([]interface{})
+	if ok {
+		return s.saveDeviceConfigs(policy, agent, confData, data)
+	}
+	data, ok = jsonData["macs"].([]interface{})
+	if ok {
+		return s.saveMacs(policy, agent, confData, data)
+	}
+	data, ok = jsonData["validation"].([]interface{})
+	if ok {
+		return s.saveValidations(policy, agent, data)
+	}
+	data, ok = jsonData["poll_errors"].([]interface{})
+	if ok {
+		return s.savePollErrors(policy, agent, data)
+	}
+	return nil, errors.New("not able to save anything from entry")
+}
+
+func (s sqliteStorage) saveLldps(policy string, agent AgentInfo, conf interface{}, lData []interface{}) (interface{}, error) {
+	lldps := make([]DbLldp, 0, len(lData))
+	var errs error
+	var configAsString string
+	if conf != nil {
+		b, err := json.Marshal(conf)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			configAsString = string(b)
+		}
+	}
+	for _, lldpData := range lData {
+		dataAsString, err := json.Marshal(lldpData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		lldp := DbLldp{
+			Id:          uuid.NewString(),
+			Config:      conf,
+			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
+			NetboxRefId: -1,
+			Blob:        string(dataAsString),
+		}
+		err = json.Unmarshal(dataAsString, &lldp)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		// a record sent again keeps the id and netbox id it was stored with
+		err = s.db.QueryRow(
+			`INSERT INTO lldp
+					( id, policy, config, namespace, hostname, name, peer_hostname, peer_name, peer_mac_address, mgmt_ip, netbox_id, json_data, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, name) DO UPDATE SET
+					config = excluded.config, peer_hostname = excluded.peer_hostname, peer_name = excluded.peer_name,
+					peer_mac_address = excluded.peer_mac_address, mgmt_ip = excluded.mgmt_ip,
+					json_data = excluded.json_data, tags = excluded.tags, peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`,
+			lldp.Id, policy, configAsString, lldp.Namespace, lldp.Hostname, lldp.Name, lldp.PeerHostname, lldp.PeerName,
+			lldp.PeerMacAddress, lldp.MgmtIp, lldp.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&lldp.Id, &lldp.NetboxRefId)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		lldps = append(lldps, lldp)
+	}
+	return lldps, errs
+}
+
+func (s sqliteStorage) saveArpnds(policy string, agent AgentInfo, conf interface{}, aData []interface{}) (interface{}, error) {
+	arpnds := make([]DbArpnd, 0, len(aData))
+	var errs error
+	var configAsString string
+	if conf != nil {
+		b, err := json.Marshal(conf)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			configAsString = string(b)
+		}
+	}
+	for _, arpndData := range aData {
+		dataAsString, err := json.Marshal(arpndData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		arpnd := DbArpnd{
+			Id:          uuid.NewString(),
+			Config:      conf,
+			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
+			NetboxRefId: -1,
+			Blob:        string(dataAsString),
+		}
+		err = json.Unmarshal(dataAsString, &arpnd)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		// a record sent again keeps the id and netbox id it was stored with
+		err = s.db.QueryRow(
+			`INSERT INTO arpnd
+					( id, policy, config, namespace, hostname, ip_address, interface, mac_address, state, netbox_id, json_data, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, ip_address) DO UPDATE SET
+					config = excluded.config, interface = excluded.interface, mac_address = excluded.mac_address,
+					state = excluded.state, json_data = excluded.json_data, tags = excluded.tags,
+					peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`,
+			arpnd.Id, policy, configAsString, arpnd.Namespace, arpnd.Hostname, arpnd.IpAddress, arpnd.Interface,
+			arpnd.MacAddress, arpnd.State, arpnd.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&arpnd.Id, &arpnd.NetboxRefId)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		arpnds = append(arpnds, arpnd)
+	}
+	return arpnds, errs
+}
+
+func (s sqliteStorage) saveRoutes(policy string, agent AgentInfo, conf interface{}, rData []interface{}) (interface{}, error) {
+	routes := make([]DbRoute, 0, len(rData))
+	var errs error
+	var configAsString string
+	if conf != nil {
+		b, err := json.Marshal(conf)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			configAsString = string(b)
+		}
+	}
+	for _, routeData := range rData {
+		dataAsString, err := json.Marshal(routeData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		route := DbRoute{
+			Id:          uuid.NewString(),
+			Config:      conf,
+			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
+			NetboxRefId: -1,
+			Blob:        string(dataAsString),
+		}
+		err = json.Unmarshal(dataAsString, &route)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		// a record sent again keeps the id and netbox id it was stored with
+		err = s.db.QueryRow(
+			`INSERT INTO routes
+					( id, policy, config, namespace, hostname, vrf, prefix, protocol, netbox_id, json_data, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, vrf, prefix) DO UPDATE SET
+					config = excluded.config, protocol = excluded.protocol, json_data = excluded.json_data,
+					tags = excluded.tags, peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`,
+			route.Id, policy, configAsString, route.Namespace, route.Hostname, route.Vrf, route.Prefix,
+			route.Protocol, route.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&route.Id, &route.NetboxRefId)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, errs
+}
+
+func (s sqliteStorage) saveBgps(policy string, agent AgentInfo, conf interface{}, bData []interface{}) (interface{}, error) {
+	bgps := make([]DbBgp, 0, len(bData))
+	var errs error
+	var configAsString string
+	if conf != nil {
+		b, err := json.Marshal(conf)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			configAsString = string(b)
+		}
+	}
+	for _, bgpData := range bData {
+		dataAsString, err := json.Marshal(bgpData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		bgp := DbBgp{
+			Id:          uuid.NewString(),
+			Config:      conf,
+			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
+			NetboxRefId: -1,
+			Blob:        string(dataAsString),
+		}
+		err = json.Unmarshal(dataAsString, &bgp)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		// a record sent again keeps the id and netbox id it was stored with
+		err = s.db.QueryRow(
+			`INSERT INTO bgp
+					( id, policy, config, namespace, hostname, vrf, peer, peer_hostname, state, asn, peer_asn, afi, safi, netbox_id, json_data, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, vrf, peer, afi, safi) DO UPDATE SET
+					config = excluded.config, peer_hostname = excluded.peer_hostname, state = excluded.state,
+					asn = excluded.asn, peer_asn = excluded.peer_asn, json_data = excluded.json_data,
+					tags = excluded.tags, peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`,
+			bgp.Id, policy, configAsString, bgp.Namespace, bgp.Hostname, bgp.Vrf, bgp.Peer, bgp.PeerHostname,
+			bgp.State, bgp.Asn, bgp.PeerAsn, bgp.Afi, bgp.Safi, bgp.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&bgp.Id, &bgp.NetboxRefId)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		bgps = append(bgps, bgp)
+	}
+	return bgps, errs
+}
+
+func (s sqliteStorage) saveDeviceConfigs(policy string, agent AgentInfo, conf interface{}, dData []interface{}) (interface{}, error) {
+	devConfigs := make([]DbDeviceConfig, 0, len(dData))
+	var errs error
+	var configAsString string
+	if conf != nil {
+		b, err := json.Marshal(conf)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			configAsString = string(b)
+		}
+	}
+	for _, devConfigData := range dData {
+		dataAsString, err := json.Marshal(devConfigData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		devConfig := DbDeviceConfig{
+			Id:           uuid.NewString(),
+			PolicyConfig: conf,
+			Policy:       policy,
+			AgentId:      agent.Id,
+			Tags:         agent.Tags,
+			NetboxRefId:  -1,
+		}
+		err = json.Unmarshal(dataAsString, &devConfig)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		hash := sha256.Sum256([]byte(devConfig.Content))
+		devConfig.Hash = hex.EncodeToString(hash[:])
+
+		var lastVersion int64
+		var lastHash string
+		err = s.db.QueryRow(`
+			SELECT version, hash
+			FROM device_configs
+			WHERE policy = $1 AND namespace = $2 AND hostname = $3 AND agent_id = $4
+			ORDER BY version DESC LIMIT 1`, policy, devConfig.Namespace, devConfig.Hostname, agent.Id).Scan(&lastVersion, &lastHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			errs = errors.Join(errs, errors.New("storage fetch device configs fail"), err)
+			continue
+		}
+		if lastHash == devConfig.Hash {
+			// running config did not change since the last version
+			continue
+		}
+		devConfig.Version = lastVersion + 1
+		devConfig.CreatedAt = time.Now().UTC()
+		_, err = s.db.Exec(
+			`INSERT INTO device_configs
+					( id, policy, config, namespace, hostname, content, version, hash, created_at, netbox_id, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13 )`,
+			devConfig.Id, policy, configAsString, devConfig.Namespace, devConfig.Hostname, devConfig.Content,
+			devConfig.Version, devConfig.Hash, devConfig.CreatedAt, devConfig.NetboxRefId, agent.Id, agent.Tags, agent.Identity)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		devConfigs = append(devConfigs, devConfig)
+	}
+	return devConfigs, errs
+}
+
+func (s sqliteStorage) saveMacs(policy string, agent AgentInfo, conf interface{}, mData []interface{}) (interface{}, error) {
+	macs := make([]DbMac, 0, len(mData))
+	var errs error
+	var configAsString string
+	if conf != nil {
+		b, err := json.Marshal(conf)
+		if err != nil {
+			errs = errors.Join(errs, err)
+		} else {
+			configAsString = string(b)
+		}
+	}
+	for _, macData := range mData {
+		dataAsString, err := json.Marshal(macData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		mac := DbMac{
+			Id:          uuid.NewString(),
+			Config:      conf,
+			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
+			NetboxRefId: -1,
+			Blob:        string(dataAsString),
+		}
+		err = json.Unmarshal(dataAsString, &mac)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		mac.MacAddress = strings.ToLower(mac.MacAddress)
+		// a record sent again keeps the id and netbox id it was stored with
+		// unless the mac moved to another interface
+		err = s.db.QueryRow(
+			`INSERT INTO macs
+					( id, policy, config, namespace, hostname, vlan, mac_address, interface, netbox_id, json_data, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, vlan, mac_address) DO UPDATE SET
+					netbox_id = CASE WHEN macs.interface = excluded.interface THEN macs.netbox_id ELSE excluded.netbox_id END,
+					config = excluded.config, interface = excluded.interface, json_data = excluded.json_data,
+					tags = excluded.tags, peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`,
+			mac.Id, policy, configAsString, mac.Namespace, mac.Hostname, mac.Vlan, mac.MacAddress, mac.Interface,
+			mac.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&mac.Id, &mac.NetboxRefId)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		macs = append(macs, mac)
+	}
+	return macs, errs
+}
+
+func (s sqliteStorage) savePollErrors(policy string, agent AgentInfo, peData []interface{}) (interface{}, error) {
+	pollErrors := make([]DbPollError, 0, len(peData))
+	var errs error
+	for _, pollErrorData := range peData {
+		dataAsString, err := json.Marshal(pollErrorData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		pollError := DbPollError{
+			Id:      uuid.NewString(),
+			Policy:  policy,
+			AgentId: agent.Id,
+			Tags:    agent.Tags,
+		}
+		err = json.Unmarshal(dataAsString, &pollError)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		_, err = s.db.Exec(
+			`INSERT INTO poll_errors
+					( id, policy, namespace, hostname, service, status, category, timestamp, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11 )`,
+			pollError.Id, policy, pollError.Namespace, pollError.Hostname, pollError.Service, pollError.Status,
+			pollError.Category, pollError.Timestamp, agent.Id, agent.Tags, agent.Identity)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		pollErrors = append(pollErrors, pollError)
+	}
+	return pollErrors, errs
+}
+
+func (s sqliteStorage) GetPollErrorsByPolicy(policy string) ([]DbPollError, error) {
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, namespace, hostname, service, status, category, timestamp
+		FROM poll_errors
+		WHERE policy = $1
+		ORDER BY timestamp DESC
+	`, policy)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch poll errors fail"), err)
+	}
+	var pollErrors []DbPollError
+	for selectResult.Next() {
+		var pollError DbPollError
+		err := selectResult.Scan(&pollError.Id, &pollError.Policy, &pollError.AgentId, &pollError.Tags, &pollError.Namespace, &pollError.Hostname,
+			&pollError.Service, &pollError.Status, &pollError.Category, &pollError.Timestamp)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create poll error struct fail"), err)
+		}
+		pollErrors = append(pollErrors, pollError)
+	}
+	return pollErrors, nil
+}
+
+func (s sqliteStorage) saveValidations(policy string, agent AgentInfo, vData []interface{}) (interface{}, error) {
+	validations := make([]DbValidation, 0, len(vData))
+	var errs error
+	for _, validationData := range vData {
+		dataAsString, err := json.Marshal(validationData)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		validation := DbValidation{
+			Id:      uuid.NewString(),
+			Policy:  policy,
+			AgentId: agent.Id,
+			Tags:    agent.Tags,
+		}
+		err = json.Unmarshal(dataAsString, &validation)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		reasonsAsString, err := json.Marshal(validation.Reasons)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		detailsAsString, err := json.Marshal(validation.Details)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		_, err = s.db.Exec(
+			`INSERT INTO validations
+					( id, policy, assertion, namespace, hostname, result, reasons, details, timestamp, agent_id, tags, peer_identity )
+				VALUES
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 )`,
+			validation.Id, policy, validation.Assertion, validation.Namespace, validation.Hostname, validation.Result,
+			reasonsAsString, detailsAsString, validation.Timestamp, agent.Id, agent.Tags, agent.Identity)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		validations = append(validations, validation)
+	}
+	return validations, errs
+}
+
+func (s sqliteStorage) GetValidationsByPolicy(policy string) ([]DbValidation, error) {
+	selectResult, err := s.db.Query(`
+		SELECT id, policy, agent_id, tags, assertion, namespace, hostname, result, reasons, details, timestamp
+		FROM validations
+		WHERE policy = $1
+		ORDER BY timestamp DESC
+	`, policy)
+	if err != nil {
+		return nil, errors.Join(errors.New("storage fetch validations fail"), err)
+	}
+	var validations []DbValidation
+	for selectResult.Next() {
+		var validation DbValidation
+		var reasonsAsString, detailsAsString string
+		err := selectResult.Scan(&validation.Id, &validation.Policy, &validation.AgentId, &validation.Tags, &validation.Assertion, &validation.Namespace,
+			&validation.Hostname, &validation.Result, &reasonsAsString, &detailsAsString, &validation.Timestamp)
+		if err != nil {
+			return nil, errors.Join(errors.New("storage create validation struct fail"), err)
+		}
+		if err = json.Unmarshal([]byte(reasonsAsString), &validation.Reasons); err != nil {
+			return nil, errors.Join(errors.New("storage validation parse fail"), err)
+		}
+		if err = json.Unmarshal([]byte(detailsAsString), &validation.Details); err != nil {
+			return nil, errors.Join(errors.New("storage validation parse fail"), err)
+		}
+		validations = append(validations, validation)
 	}
-	return nil, errors.New("not able to save anything from entry")
+	return validations, nil
 }
 
-func (s sqliteStorage) saveInventories(policy string, conf interface{}, inData []interface{}, err error) (interface{}, error) {
+func (s sqliteStorage) saveInventories(policy string, agent AgentInfo, conf interface{}, inData []interface{}, err error) (interface{}, error) {
 	inventories := make([]DbInventory, len(inData))
 	var errs error
 	var configAsString string
@@ -417,6 +1364,8 @@ func (s sqliteStorage) saveInventories(policy string, conf interface{}, inData [
 			Id:          uuid.NewString(),
 			Config:      conf,
 			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
 			NetboxRefId: -1,
 			Blob:        string(dataAsString),
 		}
@@ -427,15 +1376,22 @@ func (s sqliteStorage) saveInventories(policy string, conf interface{}, inData [
 		}
 		statement, err := s.db.Prepare(
 			`INSERT INTO inventories 
-					( id, policy, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data)
+					( id, policy, config, namespace, hostname, name, description, vendor, serial, part_num, type, netbox_id, json_data, agent_id, tags, peer_identity )
 				VALUES 
-					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13 )`)
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, name) DO UPDATE SET
+					config = excluded.config, description = excluded.description, vendor = excluded.vendor, serial = excluded.serial,
+					part_num = excluded.part_num, type = excluded.type, json_data = excluded.json_data, tags = excluded.tags,
+					peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
 		}
-		_, err = statement.Exec(inventory.Id, policy, configAsString, inventory.Namespace, inventory.Hostname, inventory.Name,
-			inventory.Descr, inventory.Vendor, inventory.Serial, inventory.PartNum, inventory.Type, inventory.NetboxRefId, dataAsString)
+		// a record sent again keeps the id and netbox id it was stored with
+		err = statement.QueryRow(inventory.Id, policy, configAsString, inventory.Namespace, inventory.Hostname, inventory.Name,
+			inventory.Descr, inventory.Vendor, inventory.Serial, inventory.PartNum, inventory.Type, inventory.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&inventory.Id, &inventory.NetboxRefId)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
@@ -445,7 +1401,7 @@ func (s sqliteStorage) saveInventories(policy string, conf interface{}, inData [
 	return inventories, errs
 }
 
-func (s sqliteStorage) saveVlans(policy string, conf interface{}, vData []interface{}, err error) (interface{}, error) {
+func (s sqliteStorage) saveVlans(policy string, agent AgentInfo, conf interface{}, vData []interface{}, err error) (interface{}, error) {
 	vlans := make([]DbVlan, len(vData))
 	var errs error
 	var configAsString string
@@ -467,6 +1423,8 @@ func (s sqliteStorage) saveVlans(policy string, conf interface{}, vData []interf
 			Id:          uuid.NewString(),
 			Config:      conf,
 			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
 			NetboxRefId: -1,
 			Blob:        string(dataAsString),
 		}
@@ -477,15 +1435,21 @@ func (s sqliteStorage) saveVlans(policy string, conf interface{}, vData []interf
 		}
 		statement, err := s.db.Prepare(
 			`INSERT INTO vlans 
-					( id, policy, config, namespace, hostname, name, state, netbox_id, json_data)
+					( id, policy, config, namespace, hostname, name, state, netbox_id, json_data, agent_id, tags, peer_identity )
 				VALUES 
-					( $1, $2, $3, $4, $5, $6, $7, $8, $9 )`)
+					( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 )
+				ON CONFLICT(agent_id, policy, namespace, hostname, name) DO UPDATE SET
+					config = excluded.config, state = excluded.state, json_data = excluded.json_data, tags = excluded.tags,
+					peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
 		}
-		_, err = statement.Exec(vlan.Id, policy, configAsString, vlan.Namespace, vlan.Hostname, vlan.Name,
-			vlan.State, vlan.NetboxRefId, dataAsString)
+		// a record sent again keeps the id and netbox id it was stored with
+		err = statement.QueryRow(vlan.Id, policy, configAsString, vlan.Namespace, vlan.Hostname, vlan.Name,
+			vlan.State, vlan.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&vlan.Id, &vlan.NetboxRefId)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
@@ -495,7 +1459,7 @@ func (s sqliteStorage) saveVlans(policy string, conf interface{}, vData []interf
 	return vlans, errs
 }
 
-func (s sqliteStorage) saveDevices(policy string, conf interface{}, dData []interface{}, err error) (interface{}, error) {
+func (s sqliteStorage) saveDevices(policy string, agent AgentInfo, conf interface{}, dData []interface{}, err error) (interface{}, error) {
 	devicesAdded := make([]DbDevice, len(dData))
 	var errs error
 	var configAsString string
@@ -516,6 +1480,8 @@ func (s sqliteStorage) saveDevices(policy string, conf interface{}, dData []inte
 		dbDevice := DbDevice{
 			Id:          uuid.NewString(),
 			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
 			Config:      conf,
 			NetboxRefId: -1,
 			Blob:        string(dataAsString),
@@ -528,14 +1494,21 @@ func (s sqliteStorage) saveDevices(policy string, conf interface{}, dData []inte
 		statement, err := s.db.Prepare(
 			`
 				INSERT INTO devices 
-					(id, policy, config, namespace, hostname, address, serial_number, model, state, vendor, os, netbox_id, json_data) 
-				VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13 )`)
+					(id, policy, config, namespace, hostname, address, serial_number, model, state, vendor, os, netbox_id, json_data, agent_id, tags, peer_identity ) 
+				VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16 )
+				ON CONFLICT(agent_id, policy, namespace, hostname) DO UPDATE SET
+					config = excluded.config, address = excluded.address, serial_number = excluded.serial_number, model = excluded.model,
+					state = excluded.state, vendor = excluded.vendor, os = excluded.os, json_data = excluded.json_data, tags = excluded.tags,
+					peer_identity = excluded.peer_identity
+				RETURNING id, netbox_id`)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
 		}
-		_, err = statement.Exec(dbDevice.Id, policy, configAsString, dbDevice.Namespace, dbDevice.Hostname, dbDevice.Address, dbDevice.SerialNumber,
-			dbDevice.Model, dbDevice.State, dbDevice.Vendor, dbDevice.Os, dbDevice.NetboxRefId, dataAsString)
+		// a record sent again keeps the id and netbox id it was stored with
+		err = statement.QueryRow(dbDevice.Id, policy, configAsString, dbDevice.Namespace, dbDevice.Hostname, dbDevice.Address, dbDevice.SerialNumber,
+			dbDevice.Model, dbDevice.State, dbDevice.Vendor, dbDevice.Os, dbDevice.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&dbDevice.Id, &dbDevice.NetboxRefId)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
@@ -545,7 +1518,7 @@ func (s sqliteStorage) saveDevices(policy string, conf interface{}, dData []inte
 	return devicesAdded, errs
 }
 
-func (s sqliteStorage) saveInterfaces(policy string, conf interface{}, ifData []interface{}, err error) (interface{}, error) {
+func (s sqliteStorage) saveInterfaces(policy string, agent AgentInfo, conf interface{}, ifData []interface{}, err error) (interface{}, error) {
 	interfacesAdded := make([]DbInterface, len(ifData))
 	var errs error
 	var configAsString string
@@ -566,6 +1539,8 @@ func (s sqliteStorage) saveInterfaces(policy string, conf interface{}, ifData []
 		dbInterface := DbInterface{
 			Id:          uuid.NewString(),
 			Policy:      policy,
+			AgentId:     agent.Id,
+			Tags:        agent.Tags,
 			Config:      conf,
 			NetboxRefId: -1,
 			Blob:        string(dataAsString),
@@ -599,14 +1574,21 @@ func (s sqliteStorage) saveInterfaces(policy string, conf interface{}, ifData []
 		}
 		statement, err := s.db.Prepare(`
 			INSERT INTO interfaces 
-			    (id, policy, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, ip_addresses, netbox_id, json_data) 
-			VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14 )`)
+			    (id, policy, config, namespace, hostname, name, admin_state, mtu, speed, mac_address, if_type, ip_addresses, netbox_id, json_data, agent_id, tags, peer_identity ) 
+			VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17 )
+			ON CONFLICT(agent_id, policy, namespace, hostname, name) DO UPDATE SET
+				config = excluded.config, admin_state = excluded.admin_state, mtu = excluded.mtu, speed = excluded.speed,
+				mac_address = excluded.mac_address, if_type = excluded.if_type, ip_addresses = excluded.ip_addresses,
+				json_data = excluded.json_data, tags = excluded.tags, peer_identity = excluded.peer_identity
+			RETURNING id, netbox_id`)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
 		}
-		_, err = statement.Exec(dbInterface.Id, policy, configAsString, dbInterface.Namespace, dbInterface.Hostname, dbInterface.Name, dbInterface.AdminState,
-			dbInterface.Mtu, dbInterface.Speed, dbInterface.MacAddress, dbInterface.IfType, ipsAsString, dbInterface.NetboxRefId, dataAsString)
+		// a record sent again keeps the id and netbox id it was stored with
+		err = statement.QueryRow(dbInterface.Id, policy, configAsString, dbInterface.Namespace, dbInterface.Hostname, dbInterface.Name, dbInterface.AdminState,
+			dbInterface.Mtu, dbInterface.Speed, dbInterface.MacAddress, dbInterface.IfType, ipsAsString, dbInterface.NetboxRefId, dataAsString, agent.Id, agent.Tags, agent.Identity).
+			Scan(&dbInterface.Id, &dbInterface.NetboxRefId)
 		if err != nil {
 			errs = errors.Join(errs, err)
 			continue
@@ -616,6 +1598,152 @@ func (s sqliteStorage) saveInterfaces(policy string, conf interface{}, ifData []
 	return interfacesAdded, errs
 }
 
+// removableTables maps the delta tables to their storage table and key columns
+var removableTables = map[string]struct {
+	table   string
+	columns map[string]string
+}{
+	"device":     {"devices", map[string]string{"namespace": "namespace", "hostname": "hostname"}},
+	"interfaces": {"interfaces", map[string]string{"namespace": "namespace", "hostname": "hostname", "ifname": "name"}},
+	"inventory":  {"inventories", map[string]string{"namespace": "namespace", "hostname": "hostname", "name": "name"}},
+}
+
+func (s sqliteStorage) RemoveRecords(policy string, agent AgentInfo, table string, keys []map[string]string) (int64, error) {
+	t, ok := removableTables[table]
+	if !ok {
+		return 0, errors.New("storage remove not supported for table " + table)
+	}
+	var removed int64
+	var errs error
+	for _, key := range keys {
+		query := "DELETE FROM " + t.table + " WHERE agent_id = $1 AND policy = $2"
+		args := []interface{}{agent.Id, policy}
+		for field, column := range t.columns {
+			args = append(args, key[field])
+			query += fmt.Sprintf(" AND %s = $%d", column, len(args))
+		}
+		res, err := s.db.Exec(query, args...)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		removed += n
+	}
+	if errs != nil {
+		return removed, errors.Join(errors.New("storage remove "+table+" fail"), errs)
+	}
+	return removed, nil
+}
+
+func (s sqliteStorage) UpdateRun(policy string, run RunInfo, table string, count int64) (DbRun, error) {
+	dbRun, err := s.getOrCreateRun(policy, run)
+	if err != nil {
+		return DbRun{}, err
+	}
+	// fragments delivered again by the transport are only counted once
+	res, err := s.db.Exec(`
+	INSERT INTO run_fragments (run_id, sequence) VALUES ( $1, $2 )
+	ON CONFLICT(run_id, sequence) DO NOTHING`, run.Id, run.Sequence)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage run fragment fail"), err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return DbRun{}, errors.Join(errors.New("storage run fragment fail"), err)
+	} else if n == 0 {
+		return dbRun, nil
+	}
+	dbRun.Fragments++
+	dbRun.Received[table] += count
+	receivedAsString, err := json.Marshal(dbRun.Received)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage run received parse fail"), err)
+	}
+	_, err = s.db.Exec(`
+	UPDATE runs SET fragments = $1, received = $2 WHERE id = $3`, dbRun.Fragments, string(receivedAsString), dbRun.Id)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage update run fail"), err)
+	}
+	return dbRun, nil
+}
+
+func (s sqliteStorage) CompleteRun(policy string, run RunInfo, tables map[string]int64) (DbRun, error) {
+	dbRun, err := s.getOrCreateRun(policy, run)
+	if err != nil {
+		return DbRun{}, err
+	}
+	dbRun.Expected = tables
+	dbRun.CompletedAt = run.Timestamp
+	// the completion record is the last one of a run, so every data fragment
+	// before it must have been received with the announced record counts
+	dbRun.Complete = dbRun.Fragments == run.Sequence-1
+	for table, count := range dbRun.Received {
+		if tables[table] != count {
+			dbRun.Complete = false
+		}
+	}
+	for table, count := range tables {
+		if dbRun.Received[table] != count {
+			dbRun.Complete = false
+		}
+	}
+	expectedAsString, err := json.Marshal(dbRun.Expected)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage run expected parse fail"), err)
+	}
+	_, err = s.db.Exec(`
+	UPDATE runs SET expected = $1, completed_at = $2, complete = $3 WHERE id = $4`,
+		string(expectedAsString), dbRun.CompletedAt, dbRun.Complete, dbRun.Id)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage complete run fail"), err)
+	}
+	return dbRun, nil
+}
+
+func (s sqliteStorage) GetRun(id string) (DbRun, error) {
+	selectResult := s.db.QueryRow(`
+		SELECT id, policy, fragments, received, expected, started_at, completed_at, complete
+		FROM runs
+		WHERE id = $1`, id)
+	var dbRun DbRun
+	var receivedAsString string
+	var expectedAsString string
+	var completedAt sql.NullTime
+	err := selectResult.Scan(&dbRun.Id, &dbRun.Policy, &dbRun.Fragments, &receivedAsString, &expectedAsString,
+		&dbRun.StartedAt, &completedAt, &dbRun.Complete)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage fetch run fail"), err)
+	}
+	dbRun.Received = make(map[string]int64)
+	if err = json.Unmarshal([]byte(receivedAsString), &dbRun.Received); err != nil {
+		return DbRun{}, errors.Join(errors.New("storage run received parse fail"), err)
+	}
+	if len(expectedAsString) > 0 {
+		if err = json.Unmarshal([]byte(expectedAsString), &dbRun.Expected); err != nil {
+			return DbRun{}, errors.Join(errors.New("storage run expected parse fail"), err)
+		}
+	}
+	if completedAt.Valid {
+		dbRun.CompletedAt = completedAt.Time
+	}
+	return dbRun, nil
+}
+
+func (s sqliteStorage) getOrCreateRun(policy string, run RunInfo) (DbRun, error) {
+	_, err := s.db.Exec(`
+		INSERT INTO runs (id, policy, fragments, received, expected, started_at, complete)
+		VALUES ( $1, $2, 0, '{}', '', $3, false )
+		ON CONFLICT(id) DO NOTHING`, run.Id, policy, run.Timestamp)
+	if err != nil {
+		return DbRun{}, errors.Join(errors.New("storage create run fail"), err)
+	}
+	return s.GetRun(run.Id)
+}
+
 func startSqliteDb(logger *zap.Logger) (db *sql.DB, err error) {
 	if !slices.Contains(sql.Drivers(), "sqlite3") {
 		logger.Error("SQLite does not have required driver", zap.Error(err))
@@ -731,8 +1859,258 @@ func startSqliteDb(logger *zap.Logger) (db *sql.DB, err error) {
 	}
 	logger.Debug("successfully created inventories table")
 
+	createLldpTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS lldp
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+			config TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	name TEXT,
+		 	peer_hostname TEXT,
+		 	peer_name TEXT,
+		 	peer_mac_address TEXT,
+		 	mgmt_ip TEXT,
+		 	netbox_id INTEGER,
+		    json_data TEXT
+		)`)
+	if err != nil {
+		logger.Error("error preparing lldp statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createLldpTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating lldp table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created lldp table")
+
+	createArpndTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS arpnd
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+			config TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	ip_address TEXT,
+		 	interface TEXT,
+		 	mac_address TEXT,
+		 	state TEXT,
+		 	netbox_id INTEGER,
+		    json_data TEXT
+		)`)
+	if err != nil {
+		logger.Error("error preparing arpnd statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createArpndTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating arpnd table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created arpnd table")
+
+	createRoutesTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS routes
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+			config TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	vrf TEXT,
+		 	prefix TEXT,
+		 	protocol TEXT,
+		 	netbox_id INTEGER,
+		    json_data TEXT
+		)`)
+	if err != nil {
+		logger.Error("error preparing routes statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createRoutesTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating routes table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created routes table")
+
+	createBgpTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS bgp
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+			config TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	vrf TEXT,
+		 	peer TEXT,
+		 	peer_hostname TEXT,
+		 	state TEXT,
+		 	asn INTEGER,
+		 	peer_asn INTEGER,
+		 	afi TEXT,
+		 	safi TEXT,
+		 	netbox_id INTEGER,
+		    json_data TEXT
+		)`)
+	if err != nil {
+		logger.Error("error preparing bgp statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createBgpTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating bgp table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created bgp table")
+
+	createDeviceConfigsTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS device_configs
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+			config TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	content TEXT,
+		 	version INTEGER,
+		 	hash TEXT,
+		 	created_at DATETIME,
+		 	netbox_id INTEGER
+		)`)
+	if err != nil {
+		logger.Error("error preparing device configs statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createDeviceConfigsTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating device configs table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created device configs table")
+
+	createMacsTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS macs
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+			config TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	vlan INTEGER,
+		 	mac_address TEXT,
+		 	interface TEXT,
+		 	netbox_id INTEGER,
+		    json_data TEXT
+		)`)
+	if err != nil {
+		logger.Error("error preparing macs statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createMacsTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating macs table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created macs table")
+
+	createPollErrorsTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS poll_errors
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	service TEXT,
+		 	status INTEGER,
+		 	category TEXT,
+		 	timestamp DATETIME
+		)`)
+	if err != nil {
+		logger.Error("error preparing poll errors statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createPollErrorsTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating poll errors table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created poll errors table")
+
+	createValidationsTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS validations
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+		 	assertion TEXT,
+		 	namespace TEXT,
+		 	hostname TEXT,
+		 	result TEXT,
+		 	reasons TEXT,
+		 	details TEXT,
+		 	timestamp DATETIME
+		)`)
+	if err != nil {
+		logger.Error("error preparing validations statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createValidationsTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating validations table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created validations table")
+
+	createRunsTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS runs
+		(
+		    id TEXT PRIMARY KEY,
+		 	policy TEXT,
+		 	fragments INTEGER,
+		 	received TEXT,
+		 	expected TEXT,
+		 	started_at DATETIME,
+		 	completed_at DATETIME,
+		 	complete BOOLEAN
+		)`)
+	if err != nil {
+		logger.Error("error preparing runs statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createRunsTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating runs table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created runs table")
+
+	createRunFragmentsTableStatement, err := db.Prepare(
+		`CREATE TABLE IF NOT EXISTS run_fragments
+		(
+		    run_id TEXT,
+		 	sequence INTEGER,
+		 	PRIMARY KEY (run_id, sequence)
+		)`)
+	if err != nil {
+		logger.Error("error preparing run fragments statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = createRunFragmentsTableStatement.Exec()
+	if err != nil {
+		logger.Error("error creating run fragments table", zap.Error(err))
+		return nil, err
+	}
+	logger.Debug("successfully created run fragments table")
+
+	if err = migrateAgentColumns(logger, db); err != nil {
+		return nil, err
+	}
+
 	constraint1TableStatement, err := db.Prepare(
-		`CREATE UNIQUE INDEX IF NOT EXISTS interfaces_uniques ON interfaces(policy, namespace, hostname, name)`)
+		`CREATE UNIQUE INDEX IF NOT EXISTS interfaces_agent_uniques ON interfaces(agent_id, policy, namespace, hostname, name)`)
 	if err != nil {
 		logger.Error("error constraints statement ", zap.Error(err))
 		return nil, err
@@ -743,7 +2121,7 @@ func startSqliteDb(logger *zap.Logger) (db *sql.DB, err error) {
 		return nil, err
 	}
 	constraint2TableStatement, err := db.Prepare(
-		`CREATE UNIQUE INDEX IF NOT EXISTS devices_uniques ON devices(policy, namespace, hostname)`)
+		`CREATE UNIQUE INDEX IF NOT EXISTS devices_agent_uniques ON devices(agent_id, policy, namespace, hostname)`)
 	if err != nil {
 		logger.Error("error constraints statement ", zap.Error(err))
 		return nil, err
@@ -754,7 +2132,7 @@ func startSqliteDb(logger *zap.Logger) (db *sql.DB, err error) {
 		return nil, err
 	}
 	constraint3TableStatement, err := db.Prepare(
-		`CREATE UNIQUE INDEX IF NOT EXISTS vlans_uniques ON vlans(policy, namespace, hostname, name)`)
+		`CREATE UNIQUE INDEX IF NOT EXISTS vlans_agent_uniques ON vlans(agent_id, policy, namespace, hostname, name)`)
 	if err != nil {
 		logger.Error("error constraints statement ", zap.Error(err))
 		return nil, err
@@ -765,7 +2143,7 @@ func startSqliteDb(logger *zap.Logger) (db *sql.DB, err error) {
 		return nil, err
 	}
 	constraint4TableStatement, err := db.Prepare(
-		`CREATE UNIQUE INDEX IF NOT EXISTS inventories_uniques ON inventories(policy, namespace, hostname, name)`)
+		`CREATE UNIQUE INDEX IF NOT EXISTS inventories_agent_uniques ON inventories(agent_id, policy, namespace, hostname, name)`)
 	if err != nil {
 		logger.Error("error constraints statement ", zap.Error(err))
 		return nil, err
@@ -775,6 +2153,128 @@ func startSqliteDb(logger *zap.Logger) (db *sql.DB, err error) {
 		logger.Error("error constraints execution", zap.Error(err))
 		return nil, err
 	}
+	constraint5TableStatement, err := db.Prepare(
+		`CREATE UNIQUE INDEX IF NOT EXISTS lldp_agent_uniques ON lldp(agent_id, policy, namespace, hostname, name)`)
+	if err != nil {
+		logger.Error("error constraints statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = constraint5TableStatement.Exec()
+	if err != nil {
+		logger.Error("error constraints execution", zap.Error(err))
+		return nil, err
+	}
+	constraint6TableStatement, err := db.Prepare(
+		`CREATE UNIQUE INDEX IF NOT EXISTS arpnd_agent_uniques ON arpnd(agent_id, policy, namespace, hostname, ip_address)`)
+	if err != nil {
+		logger.Error("error constraints statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = constraint6TableStatement.Exec()
+	if err != nil {
+		logger.Error("error constraints execution", zap.Error(err))
+		return nil, err
+	}
+	constraint7TableStatement, err := db.Prepare(
+		`CREATE UNIQUE INDEX IF NOT EXISTS routes_agent_uniques ON routes(agent_id, policy, namespace, hostname, vrf, prefix)`)
+	if err != nil {
+		logger.Error("error constraints statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = constraint7TableStatement.Exec()
+	if err != nil {
+		logger.Error("error constraints execution", zap.Error(err))
+		return nil, err
+	}
+	constraint8TableStatement, err := db.Prepare(
+		`CREATE UNIQUE INDEX IF NOT EXISTS bgp_agent_uniques ON bgp(agent_id, policy, namespace, hostname, vrf, peer, afi, safi)`)
+	if err != nil {
+		logger.Error("error constraints statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = constraint8TableStatement.Exec()
+	if err != nil {
+		logger.Error("error constraints execution", zap.Error(err))
+		return nil, err
+	}
+	constraint9TableStatement, err := db.Prepare(
+		`CREATE UNIQUE INDEX IF NOT EXISTS device_configs_agent_uniques ON device_configs(agent_id, policy, namespace, hostname, version)`)
+	if err != nil {
+		logger.Error("error constraints statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = constraint9TableStatement.Exec()
+	if err != nil {
+		logger.Error("error constraints execution", zap.Error(err))
+		return nil, err
+	}
+	constraint10TableStatement, err := db.Prepare(
+		`CREATE UNIQUE INDEX IF NOT EXISTS macs_agent_uniques ON macs(agent_id, policy, namespace, hostname, vlan, mac_address)`)
+	if err != nil {
+		logger.Error("error constraints statement ", zap.Error(err))
+		return nil, err
+	}
+	_, err = constraint10TableStatement.Exec()
+	if err != nil {
+		logger.Error("error constraints execution", zap.Error(err))
+		return nil, err
+	}
 
 	return
 }
+
+// agentTables are the tables whose records keep the agent that discovered them
+var agentTables = []string{"interfaces", "devices", "vlans", "inventories", "lldp", "arpnd", "routes", "bgp",
+	"device_configs", "macs", "poll_errors", "validations"}
+
+// migrateAgentColumns adds the agent_id, tags and peer_identity columns to
+// databases created before they existed, and drops the unique indexes that did not include the agent
+func migrateAgentColumns(logger *zap.Logger, db *sql.DB) error {
+	for _, table := range agentTables {
+		columns, err := tableColumns(db, table)
+		if err != nil {
+			logger.Error("error reading columns of "+table+" table", zap.Error(err))
+			return err
+		}
+		if !slices.Contains(columns, "agent_id") {
+			if _, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN agent_id TEXT NOT NULL DEFAULT ''`); err != nil {
+				logger.Error("error adding agent_id to "+table+" table", zap.Error(err))
+				return err
+			}
+		}
+		if !slices.Contains(columns, "tags") {
+			if _, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN tags TEXT NOT NULL DEFAULT '{}'`); err != nil {
+				logger.Error("error adding tags to "+table+" table", zap.Error(err))
+				return err
+			}
+		}
+		if !slices.Contains(columns, "peer_identity") {
+			if _, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN peer_identity TEXT NOT NULL DEFAULT ''`); err != nil {
+				logger.Error("error adding peer_identity to "+table+" table", zap.Error(err))
+				return err
+			}
+		}
+		if _, err = db.Exec(`DROP INDEX IF EXISTS ` + table + `_uniques`); err != nil {
+			logger.Error("error dropping "+table+" constraints", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+func tableColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info($1)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,252 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newTestStorage opens the storage in a temporary dir, the sqlite database
+// file being created in the working dir
+func newTestStorage(t *testing.T) Service {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+	s, err := NewSqliteStorage(zap.NewNop())
+	assert.NoError(t, err)
+	return s
+}
+
+func TestRunTracking(t *testing.T) {
+	s := newTestStorage(t)
+	started := time.Now().UTC()
+
+	_, err := s.UpdateRun("policy", RunInfo{Id: "run-1", Sequence: 1, Timestamp: started}, "device", 2)
+	assert.NoError(t, err)
+	_, err = s.UpdateRun("policy", RunInfo{Id: "run-1", Sequence: 2, Timestamp: started}, "interfaces", 5)
+	assert.NoError(t, err)
+	dbRun, err := s.CompleteRun("policy", RunInfo{Id: "run-1", Sequence: 3, Timestamp: started},
+		map[string]int64{"device": 2, "interfaces": 5})
+	assert.NoError(t, err)
+	assert.True(t, dbRun.Complete)
+
+	dbRun, err = s.GetRun("run-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "policy", dbRun.Policy)
+	assert.Equal(t, int64(2), dbRun.Fragments)
+	assert.Equal(t, map[string]int64{"device": 2, "interfaces": 5}, dbRun.Received)
+	assert.True(t, dbRun.Complete)
+}
+
+func TestRunTrackingRedelivery(t *testing.T) {
+	s := newTestStorage(t)
+	started := time.Now().UTC()
+
+	_, err := s.UpdateRun("policy", RunInfo{Id: "run-1", Sequence: 1, Timestamp: started}, "device", 2)
+	assert.NoError(t, err)
+	// the transport delivers the first fragment again
+	dbRun, err := s.UpdateRun("policy", RunInfo{Id: "run-1", Sequence: 1, Timestamp: started}, "device", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), dbRun.Fragments)
+	_, err = s.UpdateRun("policy", RunInfo{Id: "run-1", Sequence: 2, Timestamp: started}, "interfaces", 5)
+	assert.NoError(t, err)
+	// the same sequence in another run is a different fragment
+	_, err = s.UpdateRun("policy", RunInfo{Id: "run-2", Sequence: 1, Timestamp: started}, "device", 2)
+	assert.NoError(t, err)
+
+	dbRun, err = s.CompleteRun("policy", RunInfo{Id: "run-1", Sequence: 3, Timestamp: started},
+		map[string]int64{"device": 2, "interfaces": 5})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), dbRun.Fragments)
+	assert.Equal(t, map[string]int64{"device": 2, "interfaces": 5}, dbRun.Received)
+	assert.True(t, dbRun.Complete)
+
+	dbRun, err = s.GetRun("run-2")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), dbRun.Fragments)
+}
+
+func TestRunTrackingMissingFragment(t *testing.T) {
+	s := newTestStorage(t)
+	started := time.Now().UTC()
+
+	_, err := s.UpdateRun("policy", RunInfo{Id: "run-1", Sequence: 1, Timestamp: started}, "device", 2)
+	assert.NoError(t, err)
+	// the interfaces fragment of sequence 2 never arrived
+	dbRun, err := s.CompleteRun("policy", RunInfo{Id: "run-1", Sequence: 3, Timestamp: started},
+		map[string]int64{"device": 2, "interfaces": 5})
+	assert.NoError(t, err)
+	assert.False(t, dbRun.Complete)
+
+	// fragments all received, but with fewer records than announced
+	_, err = s.UpdateRun("policy", RunInfo{Id: "run-2", Sequence: 1, Timestamp: started}, "device", 1)
+	assert.NoError(t, err)
+	dbRun, err = s.CompleteRun("policy", RunInfo{Id: "run-2", Sequence: 2, Timestamp: started},
+		map[string]int64{"device": 2})
+	assert.NoError(t, err)
+	assert.False(t, dbRun.Complete)
+}
+
+func devConfig(hostname, content string) map[string]interface{} {
+	return map[string]interface{}{"devconfig": []interface{}{
+		map[string]interface{}{"namespace": "ns", "hostname": hostname, "config": content},
+	}}
+}
+
+func TestDeviceConfigVersionsPerAgent(t *testing.T) {
+	s := newTestStorage(t)
+	agent1, agent2 := AgentInfo{Id: "agent-1"}, AgentInfo{Id: "agent-2"}
+
+	for _, content := range []string{"hostname r1\n", "hostname r1\nntp server a\n"} {
+		_, err := s.Save("policy", agent1, devConfig("r1", content))
+		assert.NoError(t, err)
+	}
+	_, err := s.Save("policy", agent2, devConfig("r1", "hostname r1\nntp server b\n"))
+	assert.NoError(t, err)
+	// unchanged config, no new version
+	_, err = s.Save("policy", agent2, devConfig("r1", "hostname r1\nntp server b\n"))
+	assert.NoError(t, err)
+
+	configs, err := s.GetDeviceConfigsByPolicyAndNamespaceAndHostname("policy", "ns", "r1", "agent-1")
+	assert.NoError(t, err)
+	assert.Len(t, configs, 2)
+	configs, err = s.GetDeviceConfigsByPolicyAndNamespaceAndHostname("policy", "ns", "r1", "agent-2")
+	assert.NoError(t, err)
+	assert.Len(t, configs, 1)
+	assert.Equal(t, int64(1), configs[0].Version)
+
+	diff, err := s.GetDeviceConfigDiff("policy", "ns", "r1", "agent-1", 2)
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "+ntp server a")
+	assert.NotContains(t, diff, "ntp server b")
+
+	_, err = s.GetDeviceConfigDiff("policy", "ns", "r1", "agent-2", 2)
+	assert.Error(t, err)
+}
+
+func iface(mtu int) map[string]interface{} {
+	return map[string]interface{}{"interfaces": []interface{}{
+		map[string]interface{}{"namespace": "ns", "hostname": "r1", "ifname": "Ethernet1", "mtu": mtu,
+			"ipAddressList": []interface{}{}, "ip6AddressList": []interface{}{}},
+	}}
+}
+
+func TestSaveUpdatesResentRecords(t *testing.T) {
+	s := newTestStorage(t)
+	agent := AgentInfo{Id: "agent-1"}
+
+	saved, err := s.Save("policy", agent, iface(1500))
+	assert.NoError(t, err)
+	first := saved.([]DbInterface)[len(saved.([]DbInterface))-1]
+	_, err = s.UpdateInterface(first.Id, 42)
+	assert.NoError(t, err)
+
+	// a changed interface sent again updates the stored one
+	saved, err = s.Save("policy", agent, iface(9000))
+	assert.NoError(t, err)
+	resent := saved.([]DbInterface)[len(saved.([]DbInterface))-1]
+	assert.Equal(t, first.Id, resent.Id)
+	assert.Equal(t, int64(42), resent.NetboxRefId)
+
+	interfaces, err := s.GetInterfacesByAgent(AgentFilter{AgentId: "agent-1"})
+	assert.NoError(t, err)
+	assert.Len(t, interfaces, 1)
+	assert.Equal(t, int64(9000), interfaces[0].Mtu)
+	assert.Equal(t, int64(42), interfaces[0].NetboxRefId)
+
+	for _, model := range []string{"7050", "7280"} {
+		_, err = s.Save("policy", agent, map[string]interface{}{"device": []interface{}{
+			map[string]interface{}{"namespace": "ns", "hostname": "r1", "model": model},
+		}})
+		assert.NoError(t, err)
+	}
+	devices, err := s.GetDevicesByAgent(AgentFilter{AgentId: "agent-1"})
+	assert.NoError(t, err)
+	assert.Len(t, devices, 1)
+	assert.Equal(t, "7280", devices[0].Model)
+}
+
+func TestSaveUpdatesResentTables(t *testing.T) {
+	s := newTestStorage(t)
+	agent := AgentInfo{Id: "agent-1"}
+	for _, tc := range []struct {
+		name, table string
+		record      map[string]interface{}
+		field       string
+	}{
+		{"vlan", "vlans", map[string]interface{}{"vlanName": "vlan10"}, "state"},
+		{"lldp", "lldp", map[string]interface{}{"ifname": "Ethernet1"}, "peerHostname"},
+		{"arpnd", "arpnd", map[string]interface{}{"ipAddress": "10.0.0.5"}, "macaddr"},
+		{"routes", "routes", map[string]interface{}{"vrf": "default", "prefix": "10.0.0.0/24"}, "protocol"},
+		{"bgp", "bgp", map[string]interface{}{"vrf": "default", "peer": "10.0.0.2", "afi": "ipv4", "safi": "unicast"}, "state"},
+		{"macs", "macs", map[string]interface{}{"vlan": 10, "macaddr": "00:11:22:33:44:55"}, "oif"},
+	} {
+		var ids []string
+		for _, value := range []string{"first", "second"} {
+			record := map[string]interface{}{"namespace": "ns", "hostname": "r1", tc.field: value}
+			for k, v := range tc.record {
+				record[k] = v
+			}
+			saved, err := s.Save("policy", agent, map[string]interface{}{tc.name: []interface{}{record}})
+			assert.NoError(t, err, tc.name)
+			ids = append(ids, recordId(saved))
+		}
+		assert.Equal(t, ids[0], ids[1], tc.name)
+
+		var count int
+		var data string
+		err := s.(sqliteStorage).db.QueryRow("SELECT COUNT(*), MAX(json_data) FROM "+tc.table).Scan(&count, &data)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, 1, count, tc.name)
+		assert.Contains(t, data, "second", tc.name)
+	}
+}
+
+// recordId returns the id of the single record returned by Save
+func recordId(saved interface{}) string {
+	switch records := saved.(type) {
+	case []DbVlan:
+		return records[len(records)-1].Id
+	case []DbLldp:
+		return records[0].Id
+	case []DbArpnd:
+		return records[0].Id
+	case []DbRoute:
+		return records[0].Id
+	case []DbBgp:
+		return records[0].Id
+	case []DbMac:
+		return records[0].Id
+	}
+	return ""
+}
+
+func TestSaveResetsMovedMac(t *testing.T) {
+	s := newTestStorage(t)
+	agent := AgentInfo{Id: "agent-1"}
+	mac := func(oif string) map[string]interface{} {
+		return map[string]interface{}{"macs": []interface{}{
+			map[string]interface{}{"namespace": "ns", "hostname": "r1", "vlan": 10, "macaddr": "00:11:22:33:44:55", "oif": oif},
+		}}
+	}
+	saved, err := s.Save("policy", agent, mac("Ethernet1"))
+	assert.NoError(t, err)
+	_, err = s.UpdateMac(saved.([]DbMac)[0].Id, 7)
+	assert.NoError(t, err)
+
+	saved, err = s.Save("policy", agent, mac("Ethernet1"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), saved.([]DbMac)[0].NetboxRefId)
+	// the endpoint moved, so it is recorded again
+	saved, err = s.Save("policy", agent, mac("Ethernet2"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), saved.([]DbMac)[0].NetboxRefId)
+}
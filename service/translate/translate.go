@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"strings"
 
 	"github.com/orb-community/diode/service/config"
 	"github.com/orb-community/diode/service/nb_pusher"
@@ -24,6 +25,32 @@ type Translator interface {
 
 const invalid_id int64 = -1
 
+const (
+	cable_missing_local_interface = "local interface not discovered"
+	cable_missing_peer_device     = "peer device not discovered"
+	cable_missing_peer_interface  = "peer interface not discovered"
+	cable_one_sided               = "link only seen by one side"
+)
+
+const (
+	bgp_established     = "Established"
+	bgp_session_down    = "session not established"
+	bgp_unexpected_peer = "peer asn not documented in netbox"
+)
+
+// routes of these protocols belong to the address space documented by diode
+var documentedRouteProtocols = map[string]bool{
+	"connected": true,
+	"direct":    true,
+	"static":    true,
+}
+
+// neighbor entries in these states do not point to a live endpoint
+var invalidNeighborStates = map[string]bool{
+	"failed":     true,
+	"incomplete": true,
+}
+
 type SuzieQTranslate struct {
 	ctx    context.Context
 	logger *zap.Logger
@@ -167,12 +194,25 @@ func (st *SuzieQTranslate) Translate(data interface{}) error {
 				errs = errors.Join(errs, err)
 				continue
 			}
+			if err := st.checkExistingLldps(&newDevice); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if err := st.checkExistingBgps(&newDevice); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if err := st.checkExistingDeviceConfigs(&newDevice); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
 
 		}
 		return errs
 	} else if ifs, ok := data.([]storage.DbInterface); ok {
 
 		var errs error
+		devices := make(map[string]storage.DbDevice)
 		for _, ifce := range ifs {
 			if len(ifce.Id) == 0 {
 				continue
@@ -187,6 +227,7 @@ func (st *SuzieQTranslate) Translate(data interface{}) error {
 				errs = errors.Join(errs, err)
 				continue
 			}
+			devices[device.Id] = device
 
 			j, err := st.translateInterface(&ifce, device.NetboxRefId)
 			if err != nil {
@@ -264,6 +305,15 @@ func (st *SuzieQTranslate) Translate(data interface{}) error {
 
 			}
 		}
+		// lldp and arp/nd entries discovered before the interfaces can be resolved now
+		for _, device := range devices {
+			if err := st.checkExistingLldps(&device); err != nil {
+				errs = errors.Join(errs, err)
+			}
+			if err := st.checkExistingArpnds(&device); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
 
 		return errs
 	} else if vlans, ok := data.([]storage.DbVlan); ok {
@@ -351,6 +401,328 @@ func (st *SuzieQTranslate) Translate(data interface{}) error {
 			}
 		}
 		return errs
+	} else if lldps, ok := data.([]storage.DbLldp); ok {
+		var errs error
+		for _, lldp := range lldps {
+			if len(lldp.Id) == 0 || lldp.NetboxRefId != invalid_id {
+				continue
+			}
+			localIfs, err := st.db.GetInterfaceByPolicyAndNamespaceAndHostname(lldp.Policy, lldp.Namespace, lldp.Hostname)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if len(localIfs) == 0 {
+				// interfaces of the device were not received yet, lldp is retried with them
+				continue
+			}
+			localIf := findInterface(localIfs, lldp.Name)
+			if localIf == nil {
+				st.logCableDiff(cable_missing_local_interface, &lldp)
+				continue
+			}
+			peerDevice, err := st.findPeerDevice(&lldp)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if peerDevice == nil {
+				st.logCableDiff(cable_missing_peer_device, &lldp)
+				continue
+			}
+			peerIfs, err := st.db.GetInterfaceByPolicyAndNamespaceAndHostname(peerDevice.Policy, peerDevice.Namespace, peerDevice.Hostname)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			peerIf := findInterface(peerIfs, lldp.PeerName)
+			if peerIf == nil {
+				if len(peerIfs) > 0 {
+					st.logCableDiff(cable_missing_peer_interface, &lldp)
+				}
+				continue
+			}
+			oneSided, err := st.isOneSidedLink(&lldp, peerDevice)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if oneSided {
+				st.logCableDiff(cable_one_sided, &lldp)
+			}
+			if localIf.NetboxRefId == invalid_id || peerIf.NetboxRefId == invalid_id {
+				// cables are retried once both interfaces are created in netbox
+				continue
+			}
+			j, err := st.translateCable(localIf.NetboxRefId, peerIf.NetboxRefId)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			id, err := st.pusher.CreateCable(j)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			_, err = st.db.UpdateLldp(lldp.Id, id)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		return errs
+	} else if arpnds, ok := data.([]storage.DbArpnd); ok {
+		var errs error
+		for _, arpnd := range arpnds {
+			if len(arpnd.Id) == 0 || arpnd.NetboxRefId != invalid_id || invalidNeighborStates[arpnd.State] {
+				continue
+			}
+			ifs, err := st.db.GetInterfaceByPolicyAndNamespaceAndHostname(arpnd.Policy, arpnd.Namespace, arpnd.Hostname)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if len(ifs) == 0 {
+				// interfaces of the device were not received yet, arpnd is retried with them
+				continue
+			}
+			ifce := findInterface(ifs, arpnd.Interface)
+			if ifce != nil && ifce.NetboxRefId == invalid_id {
+				// arpnd is retried once the interface is created
+				continue
+			}
+			j, err := st.translateEndpointIpAddress(&arpnd, ifce)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if j == nil {
+				continue
+			}
+			id, err := st.pusher.CreateEndpointIpAddress(j)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			_, err = st.db.UpdateArpnd(arpnd.Id, id)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		return errs
+	} else if routes, ok := data.([]storage.DbRoute); ok {
+		var errs error
+		var diffs DiffsRoute
+		for _, route := range routes {
+			if len(route.Id) == 0 || route.NetboxRefId != invalid_id {
+				continue
+			}
+			j, err := st.translatePrefix(&route)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if j == nil {
+				continue
+			}
+			var id int64
+			if documentedRouteProtocols[route.Protocol] {
+				id, err = st.pusher.CreatePrefix(j)
+			} else {
+				id, err = st.pusher.GetPrefix(j)
+			}
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if id == invalid_id {
+				var diff DiffRouteRet
+				diff.Hostname = route.Hostname
+				diff.Vrf = route.Vrf
+				diff.Prefix = route.Prefix
+				diff.Protocol = route.Protocol
+				diffs.RouteDiffs = append(diffs.RouteDiffs, diff)
+				continue
+			}
+			_, err = st.db.UpdateRoute(route.Id, id)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		if len(diffs.RouteDiffs) > 0 {
+			ret, err := json.Marshal(diffs)
+			if err != nil {
+				errs = errors.Join(errs, err)
+			} else {
+				st.logger.Info("routes difference", zap.String("diffs: ", string(ret)))
+			}
+		}
+		return errs
+	} else if bgps, ok := data.([]storage.DbBgp); ok {
+		var errs error
+		var diffs DiffsBgp
+		// peer asns are checked before this batch documents any of them in netbox
+		knownAsns := make(map[int64]bool)
+		for _, bgp := range bgps {
+			knownAsns[bgp.Asn] = true
+		}
+		for _, bgp := range bgps {
+			if _, ok := knownAsns[bgp.PeerAsn]; ok || len(bgp.Id) == 0 || bgp.NetboxRefId != invalid_id {
+				continue
+			}
+			id, err := st.pusher.GetAsn(bgp.PeerAsn)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			knownAsns[bgp.PeerAsn] = id != invalid_id
+		}
+		for _, bgp := range bgps {
+			if len(bgp.Id) == 0 || bgp.NetboxRefId != invalid_id {
+				continue
+			}
+			device, err := st.db.GetDeviceByPolicyAndNamespaceAndHostname(bgp.Policy, bgp.Namespace, bgp.Hostname)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			} else if device.NetboxRefId == invalid_id {
+				err = errors.New("invalid device id")
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if bgp.State != bgp_established {
+				diffs.BgpDiffs = append(diffs.BgpDiffs, bgpDiff(bgp_session_down, &bgp))
+			}
+			if !knownAsns[bgp.PeerAsn] {
+				diffs.BgpDiffs = append(diffs.BgpDiffs, bgpDiff(bgp_unexpected_peer, &bgp))
+			}
+			j, err := st.translateBgp(&bgp, device.NetboxRefId)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			id, err := st.pusher.CreateBgpSession(j)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			_, err = st.db.UpdateBgp(bgp.Id, id)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		if len(diffs.BgpDiffs) > 0 {
+			ret, err := json.Marshal(diffs)
+			if err != nil {
+				errs = errors.Join(errs, err)
+			} else {
+				st.logger.Info("bgp sessions difference", zap.String("diffs: ", string(ret)))
+			}
+		}
+		return errs
+	} else if devConfigs, ok := data.([]storage.DbDeviceConfig); ok {
+		var errs error
+		for _, devConfig := range devConfigs {
+			if len(devConfig.Id) == 0 || devConfig.NetboxRefId != invalid_id {
+				continue
+			}
+			st.logger.Info("device config version stored", zap.String("hostname", devConfig.Hostname),
+				zap.Int64("version", devConfig.Version), zap.String("hash", devConfig.Hash))
+			// attaching the config to netbox is opt-in per policy
+			if !netboxConfigEnabled(devConfig.PolicyConfig, "config_backup") {
+				continue
+			}
+			device, err := st.db.GetDeviceByPolicyAndNamespaceAndHostname(devConfig.Policy, devConfig.Namespace, devConfig.Hostname)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			} else if device.NetboxRefId == invalid_id {
+				err = errors.New("invalid device id")
+				errs = errors.Join(errs, err)
+				continue
+			}
+			j, err := st.translateDeviceConfig(&devConfig, device.NetboxRefId)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			id, err := st.pusher.CreateJournalEntry(j)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			_, err = st.db.UpdateDeviceConfig(devConfig.Id, id)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		return errs
+	} else if macs, ok := data.([]storage.DbMac); ok {
+		var errs error
+		for _, mac := range macs {
+			if len(mac.Id) == 0 || mac.NetboxRefId != invalid_id {
+				continue
+			}
+			// recording endpoints in netbox is opt-in per policy
+			if !netboxConfigEnabled(mac.Config, "endpoint_journal") {
+				continue
+			}
+			locations, err := st.db.GetEndpointLocations(mac.MacAddress, st.config.Base.EndpointMaxMacs)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			for _, location := range locations {
+				if location.Policy != mac.Policy || location.Namespace != mac.Namespace ||
+					location.Hostname != mac.Hostname || location.Interface != mac.Interface {
+					continue
+				}
+				if location.InterfaceNetboxId == invalid_id {
+					break
+				}
+				j, err := st.translateEndpointLocation(&location)
+				if err != nil {
+					errs = errors.Join(errs, err)
+					break
+				}
+				id, err := st.pusher.CreateJournalEntry(j)
+				if err != nil {
+					errs = errors.Join(errs, err)
+					break
+				}
+				if _, err = st.db.UpdateMac(mac.Id, id); err != nil {
+					errs = errors.Join(errs, err)
+				}
+				break
+			}
+		}
+		return errs
+	} else if validations, ok := data.([]storage.DbValidation); ok {
+		for _, validation := range validations {
+			if validation.Result == "pass" {
+				continue
+			}
+			st.logger.Warn("device validation failure", zap.String("policy", validation.Policy),
+				zap.String("assertion", validation.Assertion), zap.String("namespace", validation.Namespace),
+				zap.String("hostname", validation.Hostname), zap.Strings("reasons", validation.Reasons))
+		}
+		return nil
+	} else if pollErrors, ok := data.([]storage.DbPollError); ok {
+		for _, pollError := range pollErrors {
+			if pollError.Category == "recovered" {
+				st.logger.Info("device poll recovered", zap.String("policy", pollError.Policy), zap.String("namespace", pollError.Namespace),
+					zap.String("hostname", pollError.Hostname), zap.String("service", pollError.Service))
+				continue
+			}
+			st.logger.Warn("device poll failure", zap.String("policy", pollError.Policy), zap.String("namespace", pollError.Namespace),
+				zap.String("hostname", pollError.Hostname), zap.String("service", pollError.Service),
+				zap.Int64("status", pollError.Status), zap.String("category", pollError.Category))
+		}
+		return nil
 	}
 
 	return errors.New("no valid translatable data found")
@@ -441,6 +813,185 @@ func (st *SuzieQTranslate) translateInventory(inv *storage.DbInventory, deviceID
 	return json.Marshal(ret)
 }
 
+// translateEndpointIpAddress assigns the address to the interface the neighbor
+// was learned on, with its subnet and vrf, falling back to an unassigned host
+// address in the global table
+func (st *SuzieQTranslate) translateEndpointIpAddress(arpnd *storage.DbArpnd, ifce *storage.DbInterface) ([]byte, error) {
+	ip := net.ParseIP(arpnd.IpAddress)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid neighbor ip address %s", arpnd.IpAddress)
+	}
+	if ip.IsLinkLocalUnicast() {
+		return nil, nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		bits = 32
+	}
+	var ret EndpointIpJsonReturn
+	ret.Address = fmt.Sprintf("%s/%d", ip.String(), bits)
+	ret.Description = fmt.Sprintf("endpoint learned on %s %s", arpnd.Hostname, arpnd.Interface)
+	if len(arpnd.MacAddress) > 0 {
+		ret.Description += " (" + arpnd.MacAddress + ")"
+	}
+	if ifce != nil {
+		ret.AsgdObjType = nb_pusher.INTERFACE_OBJ_TYPE
+		ret.AsgdObjID = ifce.NetboxRefId
+		for _, ifIp := range ifce.IpAddresses {
+			if _, ipNet, err := net.ParseCIDR(ifIp.Address); err == nil && ipNet.Contains(ip) {
+				ones, _ := ipNet.Mask.Size()
+				ret.Address = fmt.Sprintf("%s/%d", ip.String(), ones)
+				break
+			}
+		}
+		var blob struct {
+			Vrf string `json:"vrf"`
+		}
+		if err := json.Unmarshal([]byte(ifce.Blob), &blob); err == nil {
+			ret.Vrf = blob.Vrf
+		}
+	}
+	return json.Marshal(ret)
+}
+
+func (st *SuzieQTranslate) translatePrefix(route *storage.DbRoute) ([]byte, error) {
+	_, ipNet, err := net.ParseCIDR(route.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	// default routes and host routes are not part of the documented address space
+	if ones, bits := ipNet.Mask.Size(); ones == 0 || ones == bits {
+		return nil, nil
+	}
+	var ret PrefixJsonReturn
+	ret.Prefix = ipNet.String()
+	ret.Vrf = route.Vrf
+	return json.Marshal(ret)
+}
+
+func (st *SuzieQTranslate) translateBgp(bgp *storage.DbBgp, deviceID int64) ([]byte, error) {
+	var ret BgpJsonReturn
+	ret.DeviceID = deviceID
+	ret.Vrf = bgp.Vrf
+	ret.Peer = bgp.Peer
+	ret.PeerHostname = bgp.PeerHostname
+	ret.State = bgp.State
+	ret.Established = bgp.State == bgp_established
+	ret.Asn = bgp.Asn
+	ret.PeerAsn = bgp.PeerAsn
+	ret.Afi = bgp.Afi
+	ret.Safi = bgp.Safi
+	return json.Marshal(ret)
+}
+
+func bgpDiff(reason string, bgp *storage.DbBgp) DiffBgpRet {
+	var diff DiffBgpRet
+	diff.Reason = reason
+	diff.Hostname = bgp.Hostname
+	diff.Vrf = bgp.Vrf
+	diff.Peer = bgp.Peer
+	diff.PeerAsn = bgp.PeerAsn
+	diff.State = bgp.State
+	return diff
+}
+
+func (st *SuzieQTranslate) translateDeviceConfig(devConfig *storage.DbDeviceConfig, deviceID int64) ([]byte, error) {
+	var ret JournalJsonReturn
+	ret.ObjectType = nb_pusher.DEVICE_OBJ_TYPE
+	ret.ObjectID = deviceID
+	ret.Kind = "info"
+	ret.Comments = fmt.Sprintf("Running config version %d (sha256 `%s`)\n\n", devConfig.Version, devConfig.Hash)
+	if devConfig.Version > 1 {
+		diff, err := st.db.GetDeviceConfigDiff(devConfig.Policy, devConfig.Namespace, devConfig.Hostname, devConfig.AgentId,
+			devConfig.Version)
+		if err != nil {
+			return nil, err
+		}
+		ret.Comments += "Changes:\n```diff\n" + diff + "```\n\n"
+	}
+	ret.Comments += "Config:\n```\n" + devConfig.Content + "\n```"
+	return json.Marshal(ret)
+}
+
+func (st *SuzieQTranslate) translateEndpointLocation(location *storage.DbEndpointLocation) ([]byte, error) {
+	var ret JournalJsonReturn
+	ret.ObjectType = nb_pusher.INTERFACE_OBJ_TYPE
+	ret.ObjectID = location.InterfaceNetboxId
+	ret.Kind = "info"
+	ret.Comments = fmt.Sprintf("Endpoint `%s` learned on vlan %d", location.MacAddress, location.Vlan)
+	return json.Marshal(ret)
+}
+
+func (st *SuzieQTranslate) translateCable(aInterfaceID, bInterfaceID int64) ([]byte, error) {
+	var ret CableJsonReturn
+	ret.AInterfaceID = aInterfaceID
+	ret.BInterfaceID = bInterfaceID
+	return json.Marshal(ret)
+}
+
+func (st *SuzieQTranslate) findPeerDevice(lldp *storage.DbLldp) (*storage.DbDevice, error) {
+	devices, err := st.db.GetDevicesByHostname(lldp.PeerHostname)
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 && shortHostname(lldp.PeerHostname) != lldp.PeerHostname {
+		if devices, err = st.db.GetDevicesByHostname(shortHostname(lldp.PeerHostname)); err != nil {
+			return nil, err
+		}
+	}
+	// hostnames are only unique within a namespace, a peer found in another
+	// one is not linked. The device of the lldp policy is preferred
+	var peer *storage.DbDevice
+	for i, device := range devices {
+		if device.Namespace != lldp.Namespace {
+			continue
+		}
+		if device.Policy == lldp.Policy {
+			return &devices[i], nil
+		}
+		if peer == nil {
+			peer = &devices[i]
+		}
+	}
+	return peer, nil
+}
+
+// isOneSidedLink reports whether the peer advertises lldp neighbors, but none of
+// them points back to the local interface
+func (st *SuzieQTranslate) isOneSidedLink(lldp *storage.DbLldp, peerDevice *storage.DbDevice) (bool, error) {
+	peerLldps, err := st.db.GetLldpsByPolicyAndNamespaceAndHostname(peerDevice.Policy, peerDevice.Namespace, peerDevice.Hostname)
+	if err != nil {
+		return false, err
+	}
+	if len(peerLldps) == 0 {
+		return false, nil
+	}
+	for _, peerLldp := range peerLldps {
+		if peerLldp.Name == lldp.PeerName && peerLldp.PeerName == lldp.Name &&
+			shortHostname(peerLldp.PeerHostname) == shortHostname(lldp.Hostname) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (st *SuzieQTranslate) logCableDiff(reason string, lldp *storage.DbLldp) {
+	var diff DiffCableRet
+	var diffs DiffsCable
+	diff.Reason = reason
+	diff.Local.Hostname = lldp.Hostname
+	diff.Local.Interface = lldp.Name
+	diff.Peer.Hostname = lldp.PeerHostname
+	diff.Peer.Interface = lldp.PeerName
+	diffs.CableDiffs = append(diffs.CableDiffs, diff)
+	ret, err := json.Marshal(diffs)
+	if err != nil {
+		st.logger.Error("error generating cable difference", zap.Any("error: ", err))
+		return
+	}
+	st.logger.Info("cables difference", zap.String("diffs: ", string(ret)))
+}
+
 func (st *SuzieQTranslate) checkExistingInterfaces(device *storage.DbDevice) error {
 	ifs, err := st.db.GetInterfaceByPolicyAndNamespaceAndHostname(device.Policy, device.Namespace, device.Hostname)
 	if err != nil {
@@ -476,6 +1027,101 @@ func (st *SuzieQTranslate) checkExistingInventories(device *storage.DbDevice) er
 	return nil
 }
 
+func (st *SuzieQTranslate) checkExistingLldps(device *storage.DbDevice) error {
+	lldps, err := st.db.GetLldpsByPolicyAndNamespaceAndHostname(device.Policy, device.Namespace, device.Hostname)
+	if err != nil {
+		return err
+	}
+	var vLldps []storage.DbLldp
+	for _, v := range lldps {
+		if v.NetboxRefId == invalid_id {
+			vLldps = append(vLldps, v)
+		}
+	}
+	if len(vLldps) > 0 {
+		return st.Translate(vLldps)
+	}
+	return nil
+}
+
+func (st *SuzieQTranslate) checkExistingArpnds(device *storage.DbDevice) error {
+	arpnds, err := st.db.GetArpndsByPolicyAndNamespaceAndHostname(device.Policy, device.Namespace, device.Hostname)
+	if err != nil {
+		return err
+	}
+	var vArpnds []storage.DbArpnd
+	for _, v := range arpnds {
+		if v.NetboxRefId == invalid_id {
+			vArpnds = append(vArpnds, v)
+		}
+	}
+	if len(vArpnds) > 0 {
+		return st.Translate(vArpnds)
+	}
+	return nil
+}
+
+func (st *SuzieQTranslate) checkExistingBgps(device *storage.DbDevice) error {
+	bgps, err := st.db.GetBgpsByPolicyAndNamespaceAndHostname(device.Policy, device.Namespace, device.Hostname)
+	if err != nil {
+		return err
+	}
+	var vBgps []storage.DbBgp
+	for _, v := range bgps {
+		if v.NetboxRefId == invalid_id {
+			vBgps = append(vBgps, v)
+		}
+	}
+	if len(vBgps) > 0 {
+		return st.Translate(vBgps)
+	}
+	return nil
+}
+
+// checkExistingDeviceConfigs only attaches the latest config version, older
+// versions received before the device was created are kept in storage only
+func (st *SuzieQTranslate) checkExistingDeviceConfigs(device *storage.DbDevice) error {
+	devConfigs, err := st.db.GetDeviceConfigsByPolicyAndNamespaceAndHostname(device.Policy, device.Namespace, device.Hostname,
+		device.AgentId)
+	if err != nil {
+		return err
+	}
+	if len(devConfigs) == 0 || !netboxConfigEnabled(device.Config, "config_backup") {
+		return nil
+	}
+	if devConfigs[len(devConfigs)-1].NetboxRefId == invalid_id {
+		return st.Translate(devConfigs[len(devConfigs)-1:])
+	}
+	return nil
+}
+
+func netboxConfigEnabled(conf interface{}, key string) bool {
+	c, ok := conf.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	n, ok := c["netbox"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	enabled, _ := n[key].(bool)
+	return enabled
+}
+
+func findInterface(ifs []storage.DbInterface, name string) *storage.DbInterface {
+	for i := range ifs {
+		if ifs[i].Name == name {
+			return &ifs[i]
+		}
+	}
+	return nil
+}
+
+func shortHostname(hostname string) string {
+	short, _, _ := strings.Cut(hostname, ".")
+	return short
+}
+
 func removeSuffix(s string) string {
 	re := regexp.MustCompile(`:\d$`)
 	return re.ReplaceAllString(s, "")
@@ -0,0 +1,303 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/. */
+
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/orb-community/diode/service/nb_pusher"
+	"github.com/orb-community/diode/service/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeStorage struct {
+	storage.Service
+	devices    []storage.DbDevice
+	interfaces []storage.DbInterface
+	arpnds     []storage.DbArpnd
+	// updated holds the netbox id set on each record id
+	updated map[string]int64
+	err     error
+}
+
+func (f *fakeStorage) GetInterfaceByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]storage.DbInterface, error) {
+	return f.interfaces, f.err
+}
+
+func (f *fakeStorage) GetArpndsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]storage.DbArpnd, error) {
+	return f.arpnds, f.err
+}
+
+func (f *fakeStorage) UpdateArpnd(id string, netboxId int64) (storage.DbArpnd, error) {
+	f.update(id, netboxId)
+	return storage.DbArpnd{Id: id, NetboxRefId: netboxId}, f.err
+}
+
+func (f *fakeStorage) UpdateRoute(id string, netboxId int64) (storage.DbRoute, error) {
+	f.update(id, netboxId)
+	return storage.DbRoute{Id: id, NetboxRefId: netboxId}, f.err
+}
+
+func (f *fakeStorage) UpdateBgp(id string, netboxId int64) (storage.DbBgp, error) {
+	f.update(id, netboxId)
+	return storage.DbBgp{Id: id, NetboxRefId: netboxId}, f.err
+}
+
+func (f *fakeStorage) GetDeviceByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) (storage.DbDevice, error) {
+	for _, d := range f.devices {
+		if d.Policy == policy && d.Namespace == namespace && d.Hostname == hostname {
+			return d, f.err
+		}
+	}
+	return storage.DbDevice{}, errors.Join(errors.New("device not found"), f.err)
+}
+
+func (f *fakeStorage) update(id string, netboxId int64) {
+	if f.updated == nil {
+		f.updated = make(map[string]int64)
+	}
+	f.updated[id] = netboxId
+}
+
+// fakePusher records the objects sent to netbox, numbering them from 100
+type fakePusher struct {
+	nb_pusher.Pusher
+	created []map[string]interface{}
+	// prefixes documented in netbox, by vrf and prefix
+	prefixes map[string]int64
+	asns     map[int64]int64
+	// asnLookups lists the asns looked up in netbox
+	asnLookups []int64
+}
+
+func (f *fakePusher) create(j []byte) (int64, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(j, &obj); err != nil {
+		return invalid_id, err
+	}
+	f.created = append(f.created, obj)
+	return int64(99 + len(f.created)), nil
+}
+
+func (f *fakePusher) CreateEndpointIpAddress(j []byte) (int64, error) {
+	return f.create(j)
+}
+
+func (f *fakePusher) CreatePrefix(j []byte) (int64, error) {
+	return f.create(j)
+}
+
+func (f *fakePusher) GetAsn(asn int64) (int64, error) {
+	f.asnLookups = append(f.asnLookups, asn)
+	if id, ok := f.asns[asn]; ok {
+		return id, nil
+	}
+	return invalid_id, nil
+}
+
+func (f *fakePusher) CreateBgpSession(j []byte) (int64, error) {
+	return f.create(j)
+}
+
+func (f *fakePusher) GetPrefix(j []byte) (int64, error) {
+	var prefix PrefixJsonReturn
+	if err := json.Unmarshal(j, &prefix); err != nil {
+		return invalid_id, err
+	}
+	if id, ok := f.prefixes[prefix.Vrf+" "+prefix.Prefix]; ok {
+		return id, nil
+	}
+	return invalid_id, nil
+}
+
+func (f *fakeStorage) GetDevicesByHostname(hostname string) ([]storage.DbDevice, error) {
+	var devices []storage.DbDevice
+	for _, d := range f.devices {
+		if d.Hostname == hostname {
+			devices = append(devices, d)
+		}
+	}
+	return devices, f.err
+}
+
+func (f *fakeStorage) GetLldpsByPolicyAndNamespaceAndHostname(policy, namespace, hostname string) ([]storage.DbLldp, error) {
+	return nil, f.err
+}
+
+func TestFindPeerDevice(t *testing.T) {
+	db := &fakeStorage{devices: []storage.DbDevice{
+		{Policy: "other", Namespace: "dc1", Hostname: "spine1"},
+		{Policy: "policy", Namespace: "dc1", Hostname: "spine1"},
+		{Policy: "policy", Namespace: "dc2", Hostname: "spine2"},
+	}}
+	st := &SuzieQTranslate{logger: zap.NewNop(), db: db}
+
+	peer, err := st.findPeerDevice(&storage.DbLldp{Policy: "policy", Namespace: "dc1", PeerHostname: "spine1.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, &db.devices[1], peer)
+
+	// same hostname in another namespace only
+	peer, err = st.findPeerDevice(&storage.DbLldp{Policy: "policy", Namespace: "dc1", PeerHostname: "spine2"})
+	assert.NoError(t, err)
+	assert.Nil(t, peer)
+
+	peer, err = st.findPeerDevice(&storage.DbLldp{Policy: "policy", Namespace: "dc1", PeerHostname: "leaf1"})
+	assert.NoError(t, err)
+	assert.Nil(t, peer)
+}
+
+func TestCheckExistingLldpsError(t *testing.T) {
+	st := &SuzieQTranslate{logger: zap.NewNop(), db: &fakeStorage{err: errors.New("database is locked")}}
+	assert.Error(t, st.checkExistingLldps(&storage.DbDevice{Policy: "policy", Namespace: "dc1", Hostname: "spine1"}))
+}
+
+func TestTranslateArpnds(t *testing.T) {
+	db := &fakeStorage{interfaces: []storage.DbInterface{
+		{Name: "Vlan10", NetboxRefId: 7, IpAddresses: []storage.IpAddress{{Address: "10.0.10.1/24"}}, Blob: `{"vrf":"blue"}`},
+		{Name: "Vlan20", NetboxRefId: invalid_id},
+	}}
+	pusher := &fakePusher{}
+	st := &SuzieQTranslate{logger: zap.NewNop(), db: db, pusher: pusher}
+
+	assert.NoError(t, st.Translate([]storage.DbArpnd{
+		{Id: "new", Hostname: "r1", IpAddress: "10.0.10.5", Interface: "Vlan10", MacAddress: "00:11:22:33:44:55", NetboxRefId: invalid_id},
+		// already in netbox
+		{Id: "known", Hostname: "r1", IpAddress: "10.0.10.6", Interface: "Vlan10", NetboxRefId: 12},
+		// the interface is not in netbox yet
+		{Id: "pending", Hostname: "r1", IpAddress: "10.0.20.5", Interface: "Vlan20", NetboxRefId: invalid_id},
+		{Id: "unknown-if", Hostname: "r1", IpAddress: "192.168.1.5", Interface: "Ethernet9", NetboxRefId: invalid_id},
+		{Id: "link-local", Hostname: "r1", IpAddress: "fe80::1", Interface: "Vlan10", NetboxRefId: invalid_id},
+	}))
+
+	assert.Len(t, pusher.created, 2)
+	assert.Equal(t, "10.0.10.5/24", pusher.created[0]["address"])
+	assert.Equal(t, "blue", pusher.created[0]["vrf"])
+	assert.Equal(t, nb_pusher.INTERFACE_OBJ_TYPE, pusher.created[0]["assigned_object_type"])
+	assert.Equal(t, float64(7), pusher.created[0]["assigned_object_id"])
+	// learned on an interface that was not discovered, kept unassigned
+	assert.Equal(t, "192.168.1.5/32", pusher.created[1]["address"])
+	assert.NotContains(t, pusher.created[1], "assigned_object_id")
+	assert.Equal(t, map[string]int64{"new": 100, "unknown-if": 101}, db.updated)
+}
+
+func TestTranslateArpndsError(t *testing.T) {
+	db := &fakeStorage{err: errors.New("database is locked")}
+	st := &SuzieQTranslate{logger: zap.NewNop(), db: db, pusher: &fakePusher{}}
+	assert.Error(t, st.Translate([]storage.DbArpnd{{Id: "new", IpAddress: "10.0.10.5", NetboxRefId: invalid_id}}))
+	assert.Error(t, st.checkExistingArpnds(&storage.DbDevice{Policy: "policy", Namespace: "dc1", Hostname: "r1"}))
+}
+
+// loggedDiffs decodes the diffs logged once under msg
+func loggedDiffs(t *testing.T, logs *observer.ObservedLogs, msg string, diffs interface{}) {
+	entries := logs.FilterMessage(msg).All()
+	if assert.Len(t, entries, 1) {
+		assert.NoError(t, json.Unmarshal([]byte(entries[0].ContextMap()["diffs: "].(string)), diffs))
+	}
+}
+
+func TestTranslateRoutes(t *testing.T) {
+	db := &fakeStorage{}
+	pusher := &fakePusher{prefixes: map[string]int64{
+		"default 10.1.0.0/16": 20,
+		"blue 10.2.0.0/16":    21,
+	}}
+	core, logs := observer.New(zap.InfoLevel)
+	st := &SuzieQTranslate{logger: zap.New(core), db: db, pusher: pusher}
+
+	assert.NoError(t, st.Translate([]storage.DbRoute{
+		{Id: "present", Hostname: "r1", Vrf: "default", Prefix: "10.1.0.0/16", Protocol: "ospf", NetboxRefId: invalid_id},
+		{Id: "missing", Hostname: "r1", Vrf: "default", Prefix: "10.3.0.0/16", Protocol: "bgp", NetboxRefId: invalid_id},
+		// documented in another vrf only
+		{Id: "other-vrf", Hostname: "r1", Vrf: "default", Prefix: "10.2.0.0/16", Protocol: "bgp", NetboxRefId: invalid_id},
+		{Id: "vrf", Hostname: "r1", Vrf: "blue", Prefix: "10.2.0.0/16", Protocol: "bgp", NetboxRefId: invalid_id},
+		{Id: "connected", Hostname: "r1", Vrf: "blue", Prefix: "10.4.0.0/24", Protocol: "connected", NetboxRefId: invalid_id},
+		{Id: "default-route", Hostname: "r1", Vrf: "default", Prefix: "0.0.0.0/0", Protocol: "static", NetboxRefId: invalid_id},
+		{Id: "host-route", Hostname: "r1", Vrf: "default", Prefix: "10.1.0.1/32", Protocol: "bgp", NetboxRefId: invalid_id},
+		{Id: "known", Hostname: "r1", Vrf: "default", Prefix: "10.5.0.0/16", Protocol: "bgp", NetboxRefId: 30},
+	}))
+
+	// connected routes are documented, learned ones only looked up
+	if assert.Len(t, pusher.created, 1) {
+		assert.Equal(t, map[string]interface{}{"prefix": "10.4.0.0/24", "vrf": "blue"}, pusher.created[0])
+	}
+	assert.Equal(t, map[string]int64{"present": 20, "vrf": 21, "connected": 100}, db.updated)
+
+	var diffs DiffsRoute
+	loggedDiffs(t, logs, "routes difference", &diffs)
+	assert.Equal(t, []DiffRouteRet{
+		{Hostname: "r1", Vrf: "default", Prefix: "10.3.0.0/16", Protocol: "bgp"},
+		{Hostname: "r1", Vrf: "default", Prefix: "10.2.0.0/16", Protocol: "bgp"},
+	}, diffs.RouteDiffs)
+}
+
+func TestTranslateRoutesNoDiff(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	st := &SuzieQTranslate{logger: zap.New(core), db: &fakeStorage{}, pusher: &fakePusher{prefixes: map[string]int64{"default 10.1.0.0/16": 20}}}
+	assert.NoError(t, st.Translate([]storage.DbRoute{
+		{Id: "present", Hostname: "r1", Vrf: "default", Prefix: "10.1.0.0/16", Protocol: "ospf", NetboxRefId: invalid_id},
+	}))
+	assert.Zero(t, logs.FilterMessage("routes difference").Len())
+}
+
+func TestTranslateBgps(t *testing.T) {
+	db := &fakeStorage{devices: []storage.DbDevice{
+		{Policy: "policy", Namespace: "dc1", Hostname: "r1", NetboxRefId: 5},
+		{Policy: "policy", Namespace: "dc1", Hostname: "r2", NetboxRefId: 6},
+	}}
+	pusher := &fakePusher{asns: map[int64]int64{65100: 40}}
+	core, logs := observer.New(zap.InfoLevel)
+	st := &SuzieQTranslate{logger: zap.New(core), db: db, pusher: pusher}
+
+	assert.NoError(t, st.Translate([]storage.DbBgp{
+		// peering between two discovered devices
+		{Id: "r1-r2", Policy: "policy", Namespace: "dc1", Hostname: "r1", Vrf: "default", Peer: "10.0.0.2",
+			State: "Established", Asn: 65001, PeerAsn: 65002, Afi: "ipv4", Safi: "unicast", NetboxRefId: invalid_id},
+		{Id: "r2-r1", Policy: "policy", Namespace: "dc1", Hostname: "r2", Vrf: "default", Peer: "10.0.0.1",
+			State: "Established", Asn: 65002, PeerAsn: 65001, Afi: "ipv4", Safi: "unicast", NetboxRefId: invalid_id},
+		// external peer documented in netbox, session down
+		{Id: "r1-transit", Policy: "policy", Namespace: "dc1", Hostname: "r1", Vrf: "default", Peer: "192.0.2.1",
+			State: "NotEstd", Asn: 65001, PeerAsn: 65100, Afi: "ipv4", Safi: "unicast", NetboxRefId: invalid_id},
+		// external peer not documented in netbox
+		{Id: "r2-unknown", Policy: "policy", Namespace: "dc1", Hostname: "r2", Vrf: "blue", Peer: "198.51.100.1",
+			State: "Established", Asn: 65002, PeerAsn: 64999, Afi: "ipv4", Safi: "unicast", NetboxRefId: invalid_id},
+		{Id: "known", Policy: "policy", Namespace: "dc1", Hostname: "r1", Vrf: "default", Peer: "192.0.2.9",
+			State: "Established", Asn: 65001, PeerAsn: 64998, NetboxRefId: 50},
+	}))
+
+	// asns of the batch devices are known, only external peers are looked up
+	assert.ElementsMatch(t, []int64{65100, 64999}, pusher.asnLookups)
+	if assert.Len(t, pusher.created, 4) {
+		// the asns of both ends are passed on to be documented with the session
+		assert.Equal(t, float64(5), pusher.created[0]["device_id"])
+		assert.Equal(t, float64(65001), pusher.created[0]["asn"])
+		assert.Equal(t, float64(65002), pusher.created[0]["peer_asn"])
+		assert.Equal(t, true, pusher.created[0]["established"])
+		assert.Equal(t, false, pusher.created[2]["established"])
+		assert.Equal(t, float64(64999), pusher.created[3]["peer_asn"])
+	}
+	assert.Equal(t, map[string]int64{"r1-r2": 100, "r2-r1": 101, "r1-transit": 102, "r2-unknown": 103}, db.updated)
+
+	var diffs DiffsBgp
+	loggedDiffs(t, logs, "bgp sessions difference", &diffs)
+	assert.Equal(t, []DiffBgpRet{
+		{Reason: bgp_session_down, Hostname: "r1", Vrf: "default", Peer: "192.0.2.1", PeerAsn: 65100, State: "NotEstd"},
+		{Reason: bgp_unexpected_peer, Hostname: "r2", Vrf: "blue", Peer: "198.51.100.1", PeerAsn: 64999, State: "Established"},
+	}, diffs.BgpDiffs)
+}
+
+func TestTranslateBgpsDeviceNotInNetbox(t *testing.T) {
+	db := &fakeStorage{devices: []storage.DbDevice{{Policy: "policy", Namespace: "dc1", Hostname: "r1", NetboxRefId: invalid_id}}}
+	pusher := &fakePusher{}
+	st := &SuzieQTranslate{logger: zap.NewNop(), db: db, pusher: pusher}
+	assert.Error(t, st.Translate([]storage.DbBgp{
+		{Id: "r1-r2", Policy: "policy", Namespace: "dc1", Hostname: "r1", State: "Established", Asn: 65001, PeerAsn: 65001, NetboxRefId: invalid_id},
+	}))
+	assert.Empty(t, pusher.created)
+	assert.Empty(t, db.updated)
+}
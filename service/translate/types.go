@@ -57,6 +57,44 @@ type InvJsonReturn struct {
 	Serial string `json:"serial"`
 }
 
+type EndpointIpJsonReturn struct {
+	Address     string `json:"address"`
+	Vrf         string `json:"vrf"`
+	Description string `json:"description"`
+	AsgdObjType string `json:"assigned_object_type,omitempty"`
+	AsgdObjID   int64  `json:"assigned_object_id,omitempty"`
+}
+
+type PrefixJsonReturn struct {
+	Prefix string `json:"prefix"`
+	Vrf    string `json:"vrf"`
+}
+
+type BgpJsonReturn struct {
+	DeviceID     int64  `json:"device_id"`
+	Vrf          string `json:"vrf"`
+	Peer         string `json:"peer"`
+	PeerHostname string `json:"peer_hostname"`
+	State        string `json:"state"`
+	Established  bool   `json:"established"`
+	Asn          int64  `json:"asn"`
+	PeerAsn      int64  `json:"peer_asn"`
+	Afi          string `json:"afi"`
+	Safi         string `json:"safi"`
+}
+
+type JournalJsonReturn struct {
+	ObjectType string `json:"object_type"`
+	ObjectID   int64  `json:"object_id"`
+	Kind       string `json:"kind"`
+	Comments   string `json:"comments"`
+}
+
+type CableJsonReturn struct {
+	AInterfaceID int64 `json:"a_interface_id"`
+	BInterfaceID int64 `json:"b_interface_id"`
+}
+
 type DiffsDevice struct {
 	DeviceDiffs []DiffJsonDeviceRet `json:"device_diffs"`
 }
@@ -165,6 +203,46 @@ type DiffInventoriesRet struct {
 	} `json:"dev_serial,omitempty"`
 }
 
+type DiffsCable struct {
+	CableDiffs []DiffCableRet `json:"cable_diffs"`
+}
+
+type DiffCableRet struct {
+	Reason string `json:"reason"`
+	Local  struct {
+		Hostname  string `json:"hostname"`
+		Interface string `json:"interface"`
+	} `json:"local"`
+	Peer struct {
+		Hostname  string `json:"hostname"`
+		Interface string `json:"interface"`
+	} `json:"peer"`
+}
+
+type DiffsRoute struct {
+	RouteDiffs []DiffRouteRet `json:"route_diffs"`
+}
+
+type DiffRouteRet struct {
+	Hostname string `json:"hostname"`
+	Vrf      string `json:"vrf"`
+	Prefix   string `json:"prefix"`
+	Protocol string `json:"protocol"`
+}
+
+type DiffsBgp struct {
+	BgpDiffs []DiffBgpRet `json:"bgp_diffs"`
+}
+
+type DiffBgpRet struct {
+	Reason   string `json:"reason"`
+	Hostname string `json:"hostname"`
+	Vrf      string `json:"vrf"`
+	Peer     string `json:"peer"`
+	PeerAsn  int64  `json:"peer_asn"`
+	State    string `json:"state"`
+}
+
 func (DeviceJsonReturn) CheckDeviceEqual(sqDevice, dbDevice DeviceJsonReturn) (string, error) {
 	var sb strings.Builder
 	if dbDevice.Name == sqDevice.Name {
@@ -183,10 +261,14 @@ func (DeviceJsonReturn) CheckDeviceEqual(sqDevice, dbDevice DeviceJsonReturn) (s
 				DiffJsonRet.Model.SuzieQModel = sqDevice.Dtype.Model
 			}
 
-			if sqDevice.Platform.Name != dbDevice.Platform.Name {
+			if sqDevice.Platform != nil && dbDevice.Platform != nil && sqDevice.Platform.Name != dbDevice.Platform.Name {
 				DiffJsonRet.Platform.NetBoxPltName = dbDevice.Platform.Name
 				DiffJsonRet.Platform.SuzieQPltName = sqDevice.Platform.Name
 			}
+			if sqDevice.Site != nil && dbDevice.Site != nil && sqDevice.Site.Name != dbDevice.Site.Name {
+				DiffJsonRet.SiteName.NetBoxSiteName = dbDevice.Site.Name
+				DiffJsonRet.SiteName.SuzieQSiteName = sqDevice.Site.Name
+			}
 
 			if sqDevice.Status != dbDevice.Status {
 				DiffJsonRet.Status.NetBoxStatus = dbDevice.Status
@@ -196,13 +278,15 @@ func (DeviceJsonReturn) CheckDeviceEqual(sqDevice, dbDevice DeviceJsonReturn) (s
 				DiffJsonRet.Serial.NetBoxSerial = dbDevice.Serial
 				DiffJsonRet.Serial.SuzieQSerial = sqDevice.Serial
 			}
-			if sqDevice.IpAddress.Address != dbDevice.IpAddress.Address {
-				DiffJsonRet.PrimaryIP.NetBoxAddress = dbDevice.IpAddress.Address
-				DiffJsonRet.PrimaryIP.SuzieQAddress = sqDevice.IpAddress.Address
-			}
-			if sqDevice.IpAddress.Version != dbDevice.IpAddress.Version {
-				DiffJsonRet.Version.NetBoxVersion = dbDevice.IpAddress.Version
-				DiffJsonRet.Version.SuzieQVersion = sqDevice.IpAddress.Version
+			if sqDevice.IpAddress != nil && dbDevice.IpAddress != nil {
+				if sqDevice.IpAddress.Address != dbDevice.IpAddress.Address {
+					DiffJsonRet.PrimaryIP.NetBoxAddress = dbDevice.IpAddress.Address
+					DiffJsonRet.PrimaryIP.SuzieQAddress = sqDevice.IpAddress.Address
+				}
+				if sqDevice.IpAddress.Version != dbDevice.IpAddress.Version {
+					DiffJsonRet.Version.NetBoxVersion = dbDevice.IpAddress.Version
+					DiffJsonRet.Version.SuzieQVersion = sqDevice.IpAddress.Version
+				}
 			}
 
 			DiffJsonRet.Name.NetBoxName = sqDevice.Name
@@ -232,6 +316,10 @@ func (IfJsonReturn) CheckInterfaceEqual(sqInterface, dbInterface IfJsonReturn) (
 		} else {
 			var ifcDiffs DiffInterfaceRet
 			var IfcDiffsReturn DiffsInterface
+			if sqInterface.DeviceID != dbInterface.DeviceID {
+				ifcDiffs.DeviceID.SuzieQDevId = sqInterface.DeviceID
+				ifcDiffs.DeviceID.NetBoxDevId = dbInterface.DeviceID
+			}
 			if sqInterface.MacAddress != dbInterface.MacAddress {
 				ifcDiffs.MacAddress.SuzieQIfcMacAddr = sqInterface.MacAddress
 				ifcDiffs.MacAddress.NetBoxIfcMacAddr = dbInterface.MacAddress
@@ -279,6 +367,10 @@ func (InvJsonReturn) CheckInventoriesEqual(sqInventory, dbInventory InvJsonRetur
 			var DiffsRet DiffsInvRet
 
 			var DiffsInv DiffInventoriesRet
+			if sqInventory.DeviceID != dbInventory.DeviceID {
+				DiffsInv.DeviceID.SuzieQDevId = sqInventory.DeviceID
+				DiffsInv.DeviceID.NetBoxDevId = dbInventory.DeviceID
+			}
 			if sqInventory.AssetTag != dbInventory.AssetTag {
 				DiffsInv.AssetTag.SuzieQAssetTag = sqInventory.AssetTag
 				DiffsInv.AssetTag.NetBoxAssetTag = dbInventory.AssetTag